@@ -0,0 +1,208 @@
+package audit
+
+import (
+	"encoding/json"
+	"log"
+	"reflect"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mfuadfakhruzzaki/project/backend/models"
+	"gorm.io/gorm"
+)
+
+// Target types
+const (
+	TargetUser                = "user"
+	TargetRole                = "role"
+	TargetTask                = "task"
+	TargetSubTask             = "subtask"
+	TargetComment             = "comment"
+	TargetAsset               = "asset"
+	TargetProject             = "project"
+	TargetPersonalAccessToken = "personal_access_token"
+	TargetSession             = "session"
+	TargetInvitation          = "invitation"
+)
+
+// Actions
+const (
+	ActionRegister            = "auth.register"
+	ActionLogin               = "auth.login"
+	ActionLoginFailed         = "auth.login_failed"
+	ActionIdentityLink        = "auth.identity_link"
+	ActionAccountLocked       = "auth.account_locked"
+	ActionLogout              = "auth.logout"
+	ActionPasswordReset       = "auth.password_reset"
+	ActionPasswordChange      = "auth.password_change"
+	ActionEmailVerified       = "auth.email_verified"
+	ActionTwoFactorEnabled    = "auth.2fa_enabled"
+	ActionProfileUpdate       = "profile.update"
+	ActionTokenCreate         = "token.create"
+	ActionTokenRevoke         = "token.revoke"
+	ActionSessionRevoke       = "session.revoke"
+	ActionInvitationCreate    = "invitation.create"
+	ActionInvitationRevoke    = "invitation.revoke"
+	ActionInvitationAccept    = "invitation.accept"
+	ActionUserDelete          = "user.delete"
+	ActionUserStatusUpdate    = "user.status_update"
+	ActionUserRoleUpdate      = "user.role_update"
+	ActionUserTwoFactorReset  = "user.2fa_reset"
+	ActionUserUnlock          = "user.unlock"
+	ActionUserImpersonate     = "user.impersonate"
+	ActionImpersonatedRequest = "impersonation.request"
+	ActionRoleCreate          = "role.create"
+	ActionRoleUpdate          = "role.update"
+	ActionRoleDelete          = "role.delete"
+	ActionTaskCreate          = "task.create"
+	ActionTaskUpdate          = "task.update"
+	ActionTaskDelete          = "task.delete"
+	ActionSubTaskCreate       = "subtask.create"
+	ActionSubTaskUpdate       = "subtask.update"
+	ActionSubTaskDelete       = "subtask.delete"
+	ActionSubTaskReorder      = "subtask.reorder"
+	ActionCommentCreate       = "comment.create"
+	ActionCommentUpdate       = "comment.update"
+	ActionCommentDelete       = "comment.delete"
+	ActionAssetUpload         = "asset.upload"
+	ActionAssetUpdate         = "asset.update"
+	ActionAssetDelete         = "asset.delete"
+	ActionProjectCreate       = "project.create"
+	ActionProjectUpdate       = "project.update"
+	ActionProjectDelete       = "project.delete"
+	ActionProjectMemberAdd    = "project.member_add"
+	ActionProjectMemberRemove = "project.member_remove"
+)
+
+// ignoredFields change on every write and would only add noise to the diff
+var ignoredFields = map[string]bool{
+	"created_at": true,
+	"updated_at": true,
+}
+
+// Change is the old and new value of a single field
+type Change struct {
+	From interface{} `json:"from,omitempty"`
+	To   interface{} `json:"to,omitempty"`
+}
+
+// Entry describes an event to record
+type Entry struct {
+	// ActorID defaults to the authenticated user of the request
+	ActorID    *uint
+	Action     string
+	TargetType string
+	TargetID   uint
+	// Before and After are compared field by field using their JSON form, so
+	// fields hidden from JSON (like passwords) never end up in the log.
+	// Either may be nil for creations and deletions.
+	Before interface{}
+	After  interface{}
+}
+
+// Diff returns the top-level fields that differ between before and after.
+// Nested objects and lists of objects (loaded associations) are skipped.
+func Diff(before, after interface{}) map[string]Change {
+	from := flatten(before)
+	to := flatten(after)
+
+	changes := make(map[string]Change)
+	for key, value := range from {
+		if other, ok := to[key]; !ok || !reflect.DeepEqual(value, other) {
+			changes[key] = Change{From: value, To: to[key]}
+		}
+	}
+	for key, value := range to {
+		if _, ok := from[key]; !ok {
+			changes[key] = Change{To: value}
+		}
+	}
+
+	return changes
+}
+
+// flatten converts a value to its top-level scalar JSON fields. Null fields are left out,
+// so a field being set shows up with only "to" and a field being cleared with only "from".
+func flatten(value interface{}) map[string]interface{} {
+	fields := make(map[string]interface{})
+	if value == nil {
+		return fields
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fields
+	}
+
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fields
+	}
+
+	for key, v := range raw {
+		if ignoredFields[key] || v == nil {
+			continue
+		}
+		if !isScalar(v) {
+			continue
+		}
+		fields[key] = v
+	}
+
+	return fields
+}
+
+// isScalar reports whether a decoded JSON value is a plain value or a list of plain values
+func isScalar(v interface{}) bool {
+	switch value := v.(type) {
+	case map[string]interface{}:
+		return false
+	case []interface{}:
+		for _, item := range value {
+			if !isScalar(item) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Record appends an entry to the audit log. Failing to write the log is
+// reported but doesn't fail the request, since the change itself already happened.
+func Record(db *gorm.DB, c *gin.Context, entry Entry) {
+	actorID := entry.ActorID
+	if actorID == nil {
+		if currentUser, exists := c.Get("currentUser"); exists {
+			id := currentUser.(models.User).ID
+			actorID = &id
+		}
+	}
+
+	changes, err := json.Marshal(Diff(entry.Before, entry.After))
+	if err != nil {
+		log.Printf("failed to encode audit log changes: %v", err)
+		changes = []byte("{}")
+	}
+
+	// Requests made while impersonating are attributed to the user and marked with the admin
+	var impersonatorID *uint
+	if impersonator, exists := c.Get("impersonator"); exists {
+		id := impersonator.(models.User).ID
+		impersonatorID = &id
+	}
+
+	record := models.AuditLog{
+		ActorID:        actorID,
+		ImpersonatorID: impersonatorID,
+		Action:         entry.Action,
+		TargetType:     entry.TargetType,
+		TargetID:       entry.TargetID,
+		Changes:        string(changes),
+		IP:             c.ClientIP(),
+		UserAgent:      c.Request.UserAgent(),
+		CreatedAt:      time.Now(),
+	}
+	if err := db.Create(&record).Error; err != nil {
+		log.Printf("failed to write audit log (%s %s #%d): %v", entry.Action, entry.TargetType, entry.TargetID, err)
+	}
+}
@@ -2,6 +2,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 
@@ -9,7 +10,11 @@ import (
 	"github.com/joho/godotenv"
 
 	"github.com/mfuadfakhruzzaki/project/backend/config"
+	"github.com/mfuadfakhruzzaki/project/backend/mailer"
 	"github.com/mfuadfakhruzzaki/project/backend/routes"
+	"github.com/mfuadfakhruzzaki/project/backend/sso"
+	"github.com/mfuadfakhruzzaki/project/backend/storage"
+	"github.com/mfuadfakhruzzaki/project/backend/utils"
 
 	// Swagger docs
 	_ "github.com/mfuadfakhruzzaki/project/backend/docs"
@@ -40,6 +45,11 @@ func main() {
 		log.Println("No .env file found")
 	}
 
+	// Load JWT signing keys, release builds refuse to start without them
+	if err := utils.InitJWTKeys(os.Getenv("GIN_MODE") == "release"); err != nil {
+		log.Fatalf("Failed to load JWT signing keys: %v", err)
+	}
+
 	// Initialize Database
 	db := config.SetupDatabase()
 	// Migrate models
@@ -54,8 +64,26 @@ func main() {
 
 	router := gin.Default()
 
+	// Initialize Mailer (MAIL_DRIVER=smtp|log), release builds refuse to start without one
+	m, err := mailer.NewFromEnv(os.Getenv("GIN_MODE") == "release")
+	if err != nil {
+		log.Fatalf("Failed to set up mailer: %v", err)
+	}
+
+	// Initialize OpenID Connect login (OIDC_ISSUER_URL, optional)
+	idp, err := sso.NewFromEnv(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to set up OIDC: %v", err)
+	}
+
+	// Initialize asset storage (STORAGE_DRIVER=local|s3)
+	store, err := storage.NewFromEnv(context.Background())
+	if err != nil {
+		log.Fatalf("Failed to set up storage: %v", err)
+	}
+
 	// Initialize Routes
-	routes.SetupRoutes(router, db)
+	routes.SetupRoutes(router, db, m, idp, store)
 
 	// Run the server
 	port := os.Getenv("PORT")
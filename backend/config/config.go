@@ -29,14 +29,50 @@ func SetupDatabase() *gorm.DB {
 func MigrateDatabase(db *gorm.DB) {
 	err := db.AutoMigrate(
 		&models.Role{},
+		&models.Permission{},
 		&models.User{},
 		&models.Task{},
 		&models.TaskAssignment{},
 		&models.Asset{},
+		&models.Blob{},
 		&models.Comment{},
 		&models.SubTask{},
+		&models.Project{},
+		&models.ProjectMember{},
+		&models.RefreshToken{},
+		&models.Invitation{},
+		&models.Session{},
+		&models.PasswordResetToken{},
+		&models.EmailVerificationToken{},
+		&models.RecoveryCode{},
+		&models.PersonalAccessToken{},
+		&models.RoleChange{},
+		&models.AuditLog{},
+		&models.LoginThrottle{},
+		&models.UserIdentity{},
+		&models.OIDCLoginState{},
 	)
 	if err != nil {
 		log.Fatalf("Failed to migrate database: %v", err)
 	}
+
+	if err := migrateAssetPaths(db); err != nil {
+		log.Fatalf("Failed to migrate asset paths: %v", err)
+	}
+}
+
+// migrateAssetPaths turns the file paths of assets uploaded to ./uploads/ into storage keys
+// for the default local storage rooted at that directory, then drops the old column
+func migrateAssetPaths(db *gorm.DB) error {
+	if !db.Migrator().HasColumn(&models.Asset{}, "file_path") {
+		return nil
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`UPDATE assets SET storage_key = regexp_replace(file_path, '^(\./)?uploads/', '')
+			WHERE (storage_key IS NULL OR storage_key = '') AND file_path IS NOT NULL`).Error; err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&models.Asset{}, "file_path")
+	})
 }
@@ -5,21 +5,52 @@ import (
 	"log"
 
 	"github.com/mfuadfakhruzzaki/project/backend/models"
+	"github.com/mfuadfakhruzzaki/project/backend/policies"
 	"gorm.io/gorm"
 )
 
-// SeedRoles seeds the roles into the database
+// SeedRoles seeds the permissions and built-in roles into the database.
+// It is safe to run on every start: records are matched by name, the admin
+// role is topped up with permissions added since the last run, and edits made
+// to other roles are left alone.
 func SeedRoles(db *gorm.DB) {
-	var count int64
-	db.Model(&models.Role{}).Count(&count)
-	if count == 0 {
-		roles := []models.Role{
-			{ID: 1, Name: "user"},
-			{ID: 2, Name: "admin"},
+	err := db.Transaction(func(tx *gorm.DB) error {
+		permissions := make([]models.Permission, 0, len(policies.Permissions))
+		for _, p := range policies.Permissions {
+			permission := models.Permission{Name: string(p.Name)}
+			if err := tx.Where(models.Permission{Name: string(p.Name)}).
+				Assign(models.Permission{Description: p.Description}).
+				FirstOrCreate(&permission).Error; err != nil {
+				return err
+			}
+			permissions = append(permissions, permission)
 		}
-		if err := db.Create(&roles).Error; err != nil {
-			log.Fatalf("Failed to seed roles: %v", err)
+
+		// Older installs created the roles with fixed IDs, which leaves the
+		// Postgres sequence behind and breaks creating new roles
+		if tx.Dialector.Name() == "postgres" {
+			if err := tx.Exec("SELECT setval(pg_get_serial_sequence('roles', 'id'), COALESCE(MAX(id), 1)) FROM roles").Error; err != nil {
+				return err
+			}
+		}
+
+		var userRole models.Role
+		if err := tx.Where(models.Role{Name: policies.DefaultRoleName}).
+			Attrs(models.Role{Description: "Regular user"}).
+			FirstOrCreate(&userRole).Error; err != nil {
+			return err
+		}
+
+		var adminRole models.Role
+		if err := tx.Where(models.Role{Name: policies.AdminRoleName}).
+			Attrs(models.Role{Description: "Administrator with every permission"}).
+			FirstOrCreate(&adminRole).Error; err != nil {
+			return err
 		}
-		log.Println("Seeded roles successfully")
+		return tx.Model(&adminRole).Association("Permissions").Append(permissions)
+	})
+	if err != nil {
+		log.Fatalf("Failed to seed roles: %v", err)
 	}
+	log.Println("Seeded roles successfully")
 }
@@ -1,14 +1,83 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mfuadfakhruzzaki/project/backend/audit"
 	"github.com/mfuadfakhruzzaki/project/backend/models"
+	"github.com/mfuadfakhruzzaki/project/backend/policies"
+	"github.com/mfuadfakhruzzaki/project/backend/utils"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+var errLastAdmin = errors.New("last admin")
+
+// ensureNotLastAdmin returns errLastAdmin if the user is the only active user who can manage users.
+// It must run inside a transaction: the users.manage permission row is locked so concurrent
+// demotions can't each see the other admin and remove both.
+func ensureNotLastAdmin(tx *gorm.DB, userID uint) error {
+	permission, err := lockUsersManagePermission(tx)
+	if err != nil {
+		return err
+	}
+
+	var user models.User
+	if err := tx.Preload("Role.Permissions").First(&user, userID).Error; err != nil {
+		return err
+	}
+	if !user.IsActive || !policies.HasPermission(user, policies.PermUsersManage) {
+		return nil
+	}
+
+	var others int64
+	if err := tx.Model(&models.User{}).
+		Joins("JOIN role_permissions ON role_permissions.role_id = users.role_id").
+		Where("role_permissions.permission_id = ? AND users.is_active = ? AND users.id <> ?", permission.ID, true, userID).
+		Count(&others).Error; err != nil {
+		return err
+	}
+	if others == 0 {
+		return errLastAdmin
+	}
+
+	return nil
+}
+
+// ensureAdminOutsideRole returns errLastAdmin if no active user outside the role can manage users,
+// so users.manage can't be taken from the role. Like ensureNotLastAdmin it must run inside a transaction.
+func ensureAdminOutsideRole(tx *gorm.DB, roleID uint) error {
+	permission, err := lockUsersManagePermission(tx)
+	if err != nil {
+		return err
+	}
+
+	var others int64
+	if err := tx.Model(&models.User{}).
+		Joins("JOIN role_permissions ON role_permissions.role_id = users.role_id").
+		Where("role_permissions.permission_id = ? AND users.is_active = ? AND users.role_id <> ?", permission.ID, true, roleID).
+		Count(&others).Error; err != nil {
+		return err
+	}
+	if others == 0 {
+		return errLastAdmin
+	}
+
+	return nil
+}
+
+// lockUsersManagePermission locks the users.manage permission row until the transaction ends
+func lockUsersManagePermission(tx *gorm.DB) (models.Permission, error) {
+	var permission models.Permission
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("name = ?", string(policies.PermUsersManage)).First(&permission).Error
+	return permission, err
+}
+
 // GetAllUsers godoc
 // @Summary Mengambil daftar semua pengguna
 // @Description Mengambil daftar semua pengguna dengan peran mereka
@@ -52,12 +121,12 @@ func DeleteUser(db *gorm.DB) gin.HandlerFunc {
 
 		// Prevent deleting admin user
 		var user models.User
-		if err := db.Preload("Role").First(&user, id).Error; err != nil {
+		if err := db.Preload("Role.Permissions").First(&user, id).Error; err != nil {
 			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "User not found"})
 			return
 		}
 
-		if user.Role.Name == "admin" {
+		if policies.HasPermission(user, policies.PermUsersManage) {
 			c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "Cannot delete admin user"})
 			return
 		}
@@ -67,6 +136,8 @@ func DeleteUser(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		audit.Record(db, c, audit.Entry{Action: audit.ActionUserDelete, TargetType: audit.TargetUser, TargetID: user.ID, Before: user})
+
 		c.JSON(http.StatusOK, models.SuccessResponse{Message: "User deleted successfully"})
 	}
 }
@@ -105,12 +176,294 @@ func UpdateUserStatus(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		user.IsActive = input.IsActive
-		if err := db.Save(&user).Error; err != nil {
+		before := user
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if !input.IsActive {
+				if err := ensureNotLastAdmin(tx, user.ID); err != nil {
+					return err
+				}
+			}
+
+			user.IsActive = input.IsActive
+			return tx.Save(&user).Error
+		})
+		if errors.Is(err, errLastAdmin) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Cannot deactivate the last admin"})
+			return
+		}
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to update user status"})
 			return
 		}
 
+		// Deactivated users lose all their sessions
+		if !user.IsActive {
+			if err := revokeAllSessions(db, user.ID); err != nil {
+				c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to revoke sessions"})
+				return
+			}
+		}
+
+		audit.Record(db, c, audit.Entry{Action: audit.ActionUserStatusUpdate, TargetType: audit.TargetUser, TargetID: user.ID, Before: before, After: user})
+
 		c.JSON(http.StatusOK, models.SuccessResponse{Message: "User status updated successfully"})
 	}
 }
+
+// ResetUserTwoFactor godoc
+// @Summary Mereset 2FA pengguna
+// @Description Menonaktifkan 2FA pengguna dan menghapus secret serta kode pemulihannya, misalnya saat perangkat hilang
+// @Tags Admin - User Management
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Produce json
+// @Success 200 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/admin/users/{id}/2fa [delete]
+func ResetUserTwoFactor(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idParam := c.Param("id")
+		id, err := strconv.Atoi(idParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid user ID"})
+			return
+		}
+
+		var user models.User
+		if err := db.First(&user, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "User not found"})
+			return
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&user).Updates(map[string]interface{}{
+				"totp_enabled":   false,
+				"totp_secret":    "",
+				"totp_last_step": 0,
+			}).Error; err != nil {
+				return err
+			}
+			return tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to reset two-factor authentication"})
+			return
+		}
+
+		audit.Record(db, c, audit.Entry{Action: audit.ActionUserTwoFactorReset, TargetType: audit.TargetUser, TargetID: user.ID})
+
+		c.JSON(http.StatusOK, models.SuccessResponse{Message: "Two-factor authentication reset successfully"})
+	}
+}
+
+// UpdateUserRole godoc
+// @Summary Mengubah role pengguna
+// @Description Mengubah role pengguna berdasarkan ID dan mencatat admin yang melakukan perubahan. Admin tidak dapat mengubah role-nya sendiri dan admin terakhir tidak dapat diturunkan
+// @Tags Admin - User Management
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Param role body models.UpdateUserRoleRequest true "Role Update"
+// @Produce json
+// @Success 200 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/admin/users/{id}/role [put]
+func UpdateUserRole(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idParam := c.Param("id")
+		id, err := strconv.Atoi(idParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid user ID"})
+			return
+		}
+
+		var input models.UpdateUserRoleRequest
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		currentUserInterface, exists := c.Get("currentUser")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not found"})
+			return
+		}
+
+		currentUser := currentUserInterface.(models.User)
+
+		if uint(id) == currentUser.ID {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "You cannot change your own role"})
+			return
+		}
+
+		var user models.User
+		if err := db.First(&user, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "User not found"})
+			return
+		}
+
+		var role models.Role
+		if err := db.Preload("Permissions").First(&role, input.RoleID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Role not found"})
+			return
+		}
+
+		if user.RoleID == role.ID {
+			c.JSON(http.StatusOK, models.SuccessResponse{Message: "User role updated successfully"})
+			return
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			newRoleIsAdmin := policies.HasPermission(models.User{Role: role}, policies.PermUsersManage)
+			if !newRoleIsAdmin {
+				if err := ensureNotLastAdmin(tx, user.ID); err != nil {
+					return err
+				}
+			}
+
+			if err := tx.Model(&user).Update("role_id", role.ID).Error; err != nil {
+				return err
+			}
+
+			return tx.Create(&models.RoleChange{
+				UserID:      user.ID,
+				OldRoleID:   user.RoleID,
+				NewRoleID:   role.ID,
+				ChangedByID: currentUser.ID,
+				CreatedAt:   time.Now(),
+			}).Error
+		})
+		if errors.Is(err, errLastAdmin) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Cannot demote the last admin"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to update user role"})
+			return
+		}
+
+		audit.Record(db, c, audit.Entry{
+			Action:     audit.ActionUserRoleUpdate,
+			TargetType: audit.TargetUser,
+			TargetID:   user.ID,
+			Before:     map[string]interface{}{"role_id": user.RoleID},
+			After:      map[string]interface{}{"role_id": role.ID},
+		})
+
+		c.JSON(http.StatusOK, models.SuccessResponse{Message: "User role updated successfully"})
+	}
+}
+
+// UnlockUser godoc
+// @Summary Membuka kunci login pengguna
+// @Description Menghapus hitungan login gagal pengguna sehingga akun yang terkunci dapat login kembali
+// @Tags Admin - User Management
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Produce json
+// @Success 200 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/admin/users/{id}/lockout [delete]
+func UnlockUser(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idParam := c.Param("id")
+		id, err := strconv.Atoi(idParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid user ID"})
+			return
+		}
+
+		var user models.User
+		if err := db.First(&user, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "User not found"})
+			return
+		}
+
+		if err := clearLoginThrottle(db, accountThrottleKey(user.Email)); err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to unlock user"})
+			return
+		}
+
+		audit.Record(db, c, audit.Entry{Action: audit.ActionUserUnlock, TargetType: audit.TargetUser, TargetID: user.ID})
+
+		c.JSON(http.StatusOK, models.SuccessResponse{Message: "User unlocked successfully"})
+	}
+}
+
+// ImpersonateUser godoc
+// @Summary Masuk sebagai pengguna lain
+// @Description Menerbitkan token berumur pendek untuk melihat aplikasi seperti pengguna tersebut, misalnya untuk dukungan pelanggan. Token bersifat read-only kecuali IMPERSONATION_ALLOW_WRITES=true, tidak dapat menghapus data, dan setiap request dicatat di audit log
+// @Tags Admin - User Management
+// @Security BearerAuth
+// @Param id path int true "User ID"
+// @Produce json
+// @Success 200 {object} models.ImpersonationResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/admin/users/{id}/impersonate [post]
+func ImpersonateUser(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idParam := c.Param("id")
+		id, err := strconv.Atoi(idParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid user ID"})
+			return
+		}
+
+		currentUserInterface, exists := c.Get("currentUser")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not found"})
+			return
+		}
+
+		currentUser := currentUserInterface.(models.User)
+
+		if uint(id) == currentUser.ID {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "You cannot impersonate yourself"})
+			return
+		}
+
+		var user models.User
+		if err := db.Preload("Role.Permissions").First(&user, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "User not found"})
+			return
+		}
+
+		if !user.IsActive {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "User is inactive"})
+			return
+		}
+
+		// Acting as a privileged user would hand out permissions the admin may not have
+		if len(user.Role.Permissions) > 0 {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "Users with administrative permissions cannot be impersonated"})
+			return
+		}
+
+		token, err := utils.GenerateImpersonationToken(user.ID, user.TokenVersion, currentUser.ID, c.GetUint("sessionID"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to generate token"})
+			return
+		}
+
+		audit.Record(db, c, audit.Entry{Action: audit.ActionUserImpersonate, TargetType: audit.TargetUser, TargetID: user.ID})
+
+		c.JSON(http.StatusOK, models.ImpersonationResponse{
+			Token:     token,
+			ExpiresIn: int64(utils.GetImpersonationTokenTTL().Seconds()),
+			ReadOnly:  !utils.ImpersonationAllowsWrites(),
+			User:      user,
+		})
+	}
+}
@@ -2,19 +2,32 @@
 package controllers
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"mime"
 	"net/http"
+	"path"
 	"strconv"
+	"strings"
 	"time"
+	"unicode"
+	"unicode/utf8"
 
+	"github.com/gabriel-vasile/mimetype"
 	"github.com/gin-gonic/gin"
+	"github.com/mfuadfakhruzzaki/project/backend/audit"
 	"github.com/mfuadfakhruzzaki/project/backend/models"
+	"github.com/mfuadfakhruzzaki/project/backend/storage"
 	"github.com/mfuadfakhruzzaki/project/backend/utils"
 	"gorm.io/gorm"
 )
 
 // GetAssets godoc
 // @Summary Mengambil semua aset terkait tugas
-// @Description Mengambil semua aset yang terkait dengan tugas berdasarkan ID tugas
+// @Description Mengambil semua aset yang terkait dengan tugas berdasarkan ID tugas. Jika storage mendukung, setiap aset menyertakan URL unduhan langsung yang berlaku sementara
 // @Tags Assets
 // @Security BearerAuth
 // @Param id path int true "Task ID"
@@ -24,7 +37,7 @@ import (
 // @Failure 404 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /api/tasks/{id}/assets [get]
-func GetAssets(db *gorm.DB) gin.HandlerFunc {
+func GetAssets(db *gorm.DB, store storage.Storage) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		taskIDParam := c.Param("id")
 		taskID, err := strconv.Atoi(taskIDParam)
@@ -40,17 +53,14 @@ func GetAssets(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		var assets []models.Asset
-		if err := db.Where("task_id = ?", taskID).Find(&assets).Error; err != nil {
+		if err := db.Preload("Uploader").Where("task_id = ?", taskID).Order("uploaded_at DESC").Find(&assets).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to fetch assets"})
 			return
 		}
 
 		var assetResponses []models.AssetResponse
 		for _, asset := range assets {
-			assetResponses = append(assetResponses, models.AssetResponse{
-				ID:       asset.ID,
-				FilePath: asset.FilePath,
-			})
+			assetResponses = append(assetResponses, assetResponse(c, store, asset))
 		}
 
 		c.JSON(http.StatusOK, assetResponses)
@@ -59,19 +69,24 @@ func GetAssets(db *gorm.DB) gin.HandlerFunc {
 
 // UploadAsset godoc
 // @Summary Mengunggah aset ke tugas
-// @Description Mengunggah file aset dan mengaitkannya dengan tugas berdasarkan ID tugas
+// @Description Mengunggah file aset dan mengaitkannya dengan tugas berdasarkan ID tugas. Ukuran file dibatasi MAX_UPLOAD_SIZE dan jenis file ditentukan dari isinya, hanya jenis dalam UPLOAD_ALLOWED_TYPES yang diterima
 // @Tags Assets
 // @Security BearerAuth
+// @Accept multipart/form-data
 // @Param id path int true "Task ID"
 // @Param file formData file true "File to upload"
+// @Param description formData string false "Asset description"
 // @Produce json
 // @Success 201 {object} models.AssetResponse
 // @Failure 400 {object} models.ErrorResponse
 // @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
 // @Failure 404 {object} models.ErrorResponse
+// @Failure 413 {object} models.ErrorResponse
+// @Failure 415 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /api/tasks/{id}/assets [post]
-func UploadAsset(db *gorm.DB) gin.HandlerFunc {
+func UploadAsset(db *gorm.DB, store storage.Storage) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		taskIDParam := c.Param("id")
 		taskID, err := strconv.Atoi(taskIDParam)
@@ -86,52 +101,426 @@ func UploadAsset(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Get current user
+		currentUserInterface, exists := c.Get("currentUser")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not found"})
+			return
+		}
+
+		user := currentUserInterface.(models.User)
+
+		if utils.RequireVerifiedEmail() && user.EmailVerifiedAt == nil {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "Please verify your email before uploading assets"})
+			return
+		}
+
+		maxSize := utils.GetMaxUploadSize()
+		tooLarge := models.ErrorResponse{Error: "File exceeds the maximum upload size of " + strconv.FormatInt(maxSize, 10) + " bytes"}
+
+		// Stop reading the body early instead of spooling an oversized upload to disk,
+		// leaving some room for the multipart headers
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxSize+1<<20)
+
 		file, err := c.FormFile("file")
 		if err != nil {
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				c.JSON(http.StatusRequestEntityTooLarge, tooLarge)
+				return
+			}
 			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "File is required"})
 			return
 		}
-
-		// Upload file to a directory (e.g., ./uploads)
-		uploadPath := "./uploads/"
-		if err := utils.CreateDirIfNotExists(uploadPath); err != nil {
-			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to create upload directory"})
+		if file.Size > maxSize {
+			c.JSON(http.StatusRequestEntityTooLarge, tooLarge)
 			return
 		}
 
-		fileName := strconv.Itoa(int(task.ID)) + "_" + file.Filename
-		fullPath := uploadPath + fileName
+		description := c.PostForm("description")
+		if len([]rune(description)) > 1000 {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Description must be at most 1000 characters"})
+			return
+		}
 
-		if err := c.SaveUploadedFile(file, fullPath); err != nil {
-			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to save file"})
+		src, err := file.Open()
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Failed to read file"})
 			return
 		}
+		defer src.Close()
 
-		// Get current user
-		currentUserInterface, exists := c.Get("currentUser")
-		if !exists {
-			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not found"})
+		// The client's Content-Type and file extension can't be trusted, look at the content instead
+		detected, err := mimetype.DetectReader(src)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Failed to read file"})
+			return
+		}
+		if !uploadTypeAllowed(detected, utils.GetAllowedUploadTypes()) {
+			c.JSON(http.StatusUnsupportedMediaType, models.ErrorResponse{Error: "File type " + detected.String() + " is not allowed"})
+			return
+		}
+		if _, err := src.Seek(0, io.SeekStart); err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to read file"})
 			return
 		}
 
-		user := currentUserInterface.(models.User)
+		// Files are stored once per content under a key derived from their hash, so the key never
+		// contains anything the client sent and identical uploads share one stored file
+		hash := sha256.New()
+		if _, err := io.Copy(hash, src); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Failed to read file"})
+			return
+		}
+		if _, err := src.Seek(0, io.SeekStart); err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to read file"})
+			return
+		}
 
 		// Create Asset record
+		now := time.Now()
 		asset := models.Asset{
-			FilePath:   fullPath,
-			TaskID:     uint(taskID),
-			UploadedBy: user.ID,
-			UploadedAt: time.Now(),
+			OriginalFilename: sanitizeFilename(file.Filename),
+			Size:             file.Size,
+			MimeType:         detected.String(),
+			Checksum:         hex.EncodeToString(hash.Sum(nil)),
+			Description:      description,
+			TaskID:           uint(taskID),
+			UploadedBy:       user.ID,
+			UploadedAt:       now,
+			UpdatedAt:        now,
 		}
 
-		if err := db.Create(&asset).Error; err != nil {
+		ctx := c.Request.Context()
+		var createdKey string
+		err = db.Transaction(func(tx *gorm.DB) error {
+			blob, created, err := acquireBlob(tx, ctx, store, asset.Checksum, file.Size, asset.MimeType, src)
+			if err != nil {
+				return err
+			}
+			if created {
+				createdKey = blob.StorageKey
+			}
+
+			asset.BlobID = &blob.ID
+			asset.StorageKey = blob.StorageKey
+			return tx.Create(&asset).Error
+		})
+		if err != nil {
+			// The blob row was rolled back, don't leave its file behind
+			if createdKey != "" {
+				deleteStoredFile(ctx, store, createdKey)
+			}
+			log.Printf("failed to save asset for task %d: %v", task.ID, err)
 			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to save asset"})
 			return
 		}
 
-		c.JSON(http.StatusCreated, models.AssetResponse{
-			ID:       asset.ID,
-			FilePath: asset.FilePath,
+		audit.Record(db, c, audit.Entry{Action: audit.ActionAssetUpload, TargetType: audit.TargetAsset, TargetID: asset.ID, After: asset})
+
+		if err := db.Preload("Uploader").First(&asset, asset.ID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to fetch asset"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, assetResponse(c, store, asset))
+	}
+}
+
+// DownloadAsset godoc
+// @Summary Mengunduh aset
+// @Description Mengunduh file aset dengan nama file aslinya. Mendukung permintaan sebagian melalui header Range dan validasi cache melalui ETag/If-None-Match
+// @Tags Assets
+// @Security BearerAuth
+// @Param id path int true "Task ID"
+// @Param assetId path int true "Asset ID"
+// @Param Range header string false "Byte range, misalnya bytes=0-1023"
+// @Param If-None-Match header string false "ETag dari unduhan sebelumnya"
+// @Produce octet-stream
+// @Success 200 {file} file
+// @Success 206 {file} file
+// @Success 304 "Not Modified"
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 416 "Range Not Satisfiable"
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/tasks/{id}/assets/{assetId}/download [get]
+func DownloadAsset(db *gorm.DB, store storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		taskID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid task ID"})
+			return
+		}
+
+		assetID, err := strconv.Atoi(c.Param("assetId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid asset ID"})
+			return
+		}
+
+		var asset models.Asset
+		if err := db.Where("task_id = ?", taskID).First(&asset, assetID).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Asset not found"})
+			return
+		}
+
+		ctx := c.Request.Context()
+		object, err := store.Stat(ctx, asset.StorageKey)
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Asset file not found"})
+			return
+		}
+		if err != nil {
+			log.Printf("failed to stat asset %d: %v", asset.ID, err)
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to read asset"})
+			return
+		}
+
+		file, err := store.Get(ctx, asset.StorageKey)
+		if errors.Is(err, storage.ErrNotFound) {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Asset file not found"})
+			return
+		}
+		if err != nil {
+			log.Printf("failed to open asset %d: %v", asset.ID, err)
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to read asset"})
+			return
+		}
+		defer file.Close()
+
+		filename := assetFilename(asset)
+
+		// http.ServeContent sniffs the type from the name or content when neither is known
+		if asset.MimeType != "" {
+			c.Header("Content-Type", asset.MimeType)
+		} else if object.ContentType != "" {
+			c.Header("Content-Type", object.ContentType)
+		}
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+		c.Header("ETag", assetETag(asset, object))
+		// Uploaded files are untrusted, browsers must not reinterpret them as something else
+		c.Header("X-Content-Type-Options", "nosniff")
+		c.Header("Cache-Control", "private, no-cache")
+
+		// ServeContent answers Range, If-Range and If-None-Match requests
+		http.ServeContent(c.Writer, c.Request, filename, object.ModTime, file)
+	}
+}
+
+// UpdateAsset godoc
+// @Summary Memperbarui aset
+// @Description Mengganti nama file atau deskripsi aset. File yang tersimpan tidak diubah
+// @Tags Assets
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Task ID"
+// @Param assetId path int true "Asset ID"
+// @Param asset body models.UpdateAssetInput true "Update Asset"
+// @Success 200 {object} models.AssetResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/tasks/{id}/assets/{assetId} [put]
+func UpdateAsset(db *gorm.DB, store storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		taskID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid task ID"})
+			return
+		}
+
+		assetID, err := strconv.Atoi(c.Param("assetId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid asset ID"})
+			return
+		}
+
+		var input models.UpdateAssetInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		var asset models.Asset
+		if err := db.Where("task_id = ?", taskID).First(&asset, assetID).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Asset not found"})
+			return
+		}
+
+		before := asset
+
+		if input.OriginalFilename != "" {
+			asset.OriginalFilename = sanitizeFilename(input.OriginalFilename)
+		}
+		if input.Description != nil {
+			asset.Description = *input.Description
+		}
+		asset.UpdatedAt = time.Now()
+
+		if err := db.Save(&asset).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to update asset"})
+			return
+		}
+
+		audit.Record(db, c, audit.Entry{Action: audit.ActionAssetUpdate, TargetType: audit.TargetAsset, TargetID: asset.ID, Before: before, After: asset})
+
+		if err := db.Preload("Uploader").First(&asset, asset.ID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to fetch updated asset"})
+			return
+		}
+
+		c.JSON(http.StatusOK, assetResponse(c, store, asset))
+	}
+}
+
+// DeleteAsset godoc
+// @Summary Menghapus aset
+// @Description Menghapus aset. File yang tersimpan dihapus setelah tidak ada lagi aset dengan isi yang sama
+// @Tags Assets
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Task ID"
+// @Param assetId path int true "Asset ID"
+// @Success 200 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/tasks/{id}/assets/{assetId} [delete]
+func DeleteAsset(db *gorm.DB, store storage.Storage) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		taskID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid task ID"})
+			return
+		}
+
+		assetID, err := strconv.Atoi(c.Param("assetId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid asset ID"})
+			return
+		}
+
+		var asset models.Asset
+		if err := db.Where("task_id = ?", taskID).First(&asset, assetID).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Asset not found"})
+			return
+		}
+
+		// The stored file is shared with every asset of the same content and only removed with the last one
+		var unused []string
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Delete(&asset).Error; err != nil {
+				return err
+			}
+			unused, err = releaseAssetFiles(tx, []models.Asset{asset})
+			return err
 		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to delete asset"})
+			return
+		}
+
+		for _, key := range unused {
+			deleteStoredFile(c.Request.Context(), store, key)
+		}
+
+		audit.Record(db, c, audit.Entry{Action: audit.ActionAssetDelete, TargetType: audit.TargetAsset, TargetID: asset.ID, Before: asset})
+
+		c.JSON(http.StatusOK, models.SuccessResponse{Message: "Asset deleted successfully"})
+	}
+}
+
+// assetFilename returns the name the file was uploaded with. Assets from before original names
+// were recorded used "<task id>_<name>" as their key.
+func assetFilename(asset models.Asset) string {
+	if asset.OriginalFilename != "" {
+		return asset.OriginalFilename
 	}
+	return strings.TrimPrefix(path.Base(asset.StorageKey), strconv.Itoa(int(asset.TaskID))+"_")
+}
+
+// sanitizeFilename keeps the last element of a client supplied name without control characters,
+// so it is safe to show and to send back in Content-Disposition
+func sanitizeFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+
+	if name == "" || name == "." || name == ".." || name == "/" {
+		return "file"
+	}
+
+	// Cut long names on a rune boundary
+	if len(name) > 255 {
+		cut := 255
+		for cut > 0 && !utf8.RuneStart(name[cut]) {
+			cut--
+		}
+		name = name[:cut]
+	}
+	return name
+}
+
+// uploadTypeAllowed reports whether the detected type matches an allowed type or family ("image/*")
+func uploadTypeAllowed(detected *mimetype.MIME, allowed []string) bool {
+	for _, t := range allowed {
+		if family, ok := strings.CutSuffix(t, "/*"); ok {
+			if strings.HasPrefix(detected.String(), family+"/") {
+				return true
+			}
+		} else if detected.Is(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// assetETag identifies a version of the stored file. Assets uploaded before checksums were
+// recorded fall back to the object's key, size and modification time.
+func assetETag(asset models.Asset, object storage.Object) string {
+	if asset.Checksum != "" {
+		return `"` + asset.Checksum + `"`
+	}
+	sum := sha256.Sum256([]byte(object.Key + "\x00" + strconv.FormatInt(object.Size, 10) + "\x00" + strconv.FormatInt(object.ModTime.UnixNano(), 10)))
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// assetResponse builds the response for an asset, with a direct download link when the
+// storage backend can sign one. Failing to sign only omits the link.
+func assetResponse(c *gin.Context, store storage.Storage, asset models.Asset) models.AssetResponse {
+	response := models.AssetResponse{
+		ID:               asset.ID,
+		TaskID:           asset.TaskID,
+		StorageKey:       asset.StorageKey,
+		OriginalFilename: assetFilename(asset),
+		Size:             asset.Size,
+		MimeType:         asset.MimeType,
+		Checksum:         asset.Checksum,
+		Description:      asset.Description,
+		Uploader:         asset.Uploader,
+		UploadedAt:       asset.UploadedAt,
+		UpdatedAt:        asset.UpdatedAt,
+	}
+
+	url, err := store.SignedURL(c.Request.Context(), asset.StorageKey, utils.GetSignedURLTTL(), response.OriginalFilename, asset.MimeType)
+	if err == nil {
+		response.URL = url
+	} else if !errors.Is(err, storage.ErrSignedURLUnsupported) {
+		log.Printf("failed to sign URL for asset %d: %v", asset.ID, err)
+	}
+
+	return response
 }
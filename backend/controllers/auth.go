@@ -2,11 +2,16 @@
 package controllers
 
 import (
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mfuadfakhruzzaki/project/backend/audit"
+	"github.com/mfuadfakhruzzaki/project/backend/mailer"
 	"github.com/mfuadfakhruzzaki/project/backend/models"
+	"github.com/mfuadfakhruzzaki/project/backend/passwords"
+	"github.com/mfuadfakhruzzaki/project/backend/policies"
 	"github.com/mfuadfakhruzzaki/project/backend/utils"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
@@ -14,17 +19,27 @@ import (
 
 // Register godoc
 // @Summary Registrasi pengguna baru
-// @Description Mendaftarkan pengguna baru ke sistem
+// @Description Mendaftarkan pengguna baru ke sistem dan mengirim email verifikasi. Hanya tersedia jika REGISTRATION_MODE=open, selain itu akun dibuat melalui undangan
 // @Tags Auth
 // @Accept json
 // @Produce json
 // @Param register body models.RegisterInput true "Register Input"
 // @Success 201 {object} models.SuccessResponse
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /register [post]
-func Register(db *gorm.DB) gin.HandlerFunc {
+func Register(db *gorm.DB, m mailer.Mailer) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		switch utils.GetRegistrationMode() {
+		case utils.RegistrationInviteOnly:
+			c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "Registration is by invitation only"})
+			return
+		case utils.RegistrationDisabled:
+			c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "Registration is disabled"})
+			return
+		}
+
 		var input models.RegisterInput
 		if err := c.ShouldBindJSON(&input); err != nil {
 			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
@@ -38,6 +53,11 @@ func Register(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		if err := passwords.Validate(input.Password, input.Username, input.Email); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+
 		// Hash password
 		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
 		if err != nil {
@@ -45,9 +65,9 @@ func Register(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Assign default role (assume role_id = 1 adalah 'user')
+		// Assign default role
 		var role models.Role
-		if err := db.First(&role, 1).Error; err != nil {
+		if err := db.Where("name = ?", policies.DefaultRoleName).First(&role).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Default role not found"})
 			return
 		}
@@ -67,13 +87,21 @@ func Register(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		c.JSON(http.StatusCreated, models.SuccessResponse{Message: "User registered successfully"})
+		// The account is usable right away, the user can ask for a new email if this one gets lost
+		if err := sendVerificationEmail(db, m, user); err != nil {
+			log.Printf("failed to send verification email: %v", err)
+		}
+
+		audit.Record(db, c, audit.Entry{ActorID: &user.ID, Action: audit.ActionRegister, TargetType: audit.TargetUser, TargetID: user.ID, After: user})
+
+		c.JSON(http.StatusCreated, models.SuccessResponse{Message: "User registered successfully. Please check your email to verify your address"})
 	}
 }
 
 // Login godoc
 // @Summary Login pengguna
-// @Description Mengautentikasi pengguna dan menghasilkan token JWT
+// @Description Mengautentikasi pengguna dan menghasilkan token akses JWT berumur pendek serta refresh token. Jika 2FA aktif, mengembalikan challenge token untuk /login/2fa
+// @Description (lihat models.TwoFactorChallengeResponse). Percobaan gagal berulang per akun dan per IP diperlambat secara eksponensial lalu dikunci sementara (429)
 // @Tags Auth
 // @Accept json
 // @Produce json
@@ -81,6 +109,7 @@ func Register(db *gorm.DB) gin.HandlerFunc {
 // @Success 200 {object} models.TokenResponse
 // @Failure 400 {object} models.ErrorResponse
 // @Failure 401 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /login [post]
 func Login(db *gorm.DB) gin.HandlerFunc {
@@ -91,30 +120,82 @@ func Login(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		if !checkLoginThrottle(db, c, input.Email) {
+			return
+		}
+
 		var user models.User
 		if err := db.Preload("Role").Where("email = ?", input.Email).First(&user).Error; err != nil {
+			recordLoginFailure(db, c, 0, input.Email, "unknown_email")
 			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "Invalid email or password"})
 			return
 		}
 
 		// Compare password
 		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
+			recordLoginFailure(db, c, user.ID, input.Email, "invalid_password")
 			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "Invalid email or password"})
 			return
 		}
 
 		if !user.IsActive {
+			recordLoginFailure(db, c, user.ID, input.Email, "inactive")
 			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User is inactive"})
 			return
 		}
 
-		// Generate JWT token
-		token, err := utils.GenerateToken(user.ID)
+		// With 2FA enabled the password only earns a challenge for /login/2fa
+		if user.TOTPEnabled {
+			challenge, err := utils.GenerateTwoFactorChallenge(user.ID, user.TokenVersion)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to generate token"})
+				return
+			}
+			c.JSON(http.StatusOK, models.TwoFactorChallengeResponse{TwoFactorRequired: true, ChallengeToken: challenge})
+			return
+		}
+
+		// Generate access and refresh tokens
+		tokens, _, err := issueTokens(db, c, user, "")
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to generate token"})
 			return
 		}
 
-		c.JSON(http.StatusOK, models.TokenResponse{Token: token})
+		if err := clearLoginThrottle(db, accountThrottleKey(user.Email)); err != nil {
+			log.Printf("failed to reset login attempts: %v", err)
+		}
+		audit.Record(db, c, audit.Entry{ActorID: &user.ID, Action: audit.ActionLogin, TargetType: audit.TargetUser, TargetID: user.ID})
+
+		c.JSON(http.StatusOK, tokens)
+	}
+}
+
+// recordLoginFailure counts a failed login against the client IP and the account and writes it
+// to the audit log. userID is 0 for unknown emails.
+func recordLoginFailure(db *gorm.DB, c *gin.Context, userID uint, email, reason string) {
+	audit.Record(db, c, audit.Entry{
+		Action:     audit.ActionLoginFailed,
+		TargetType: audit.TargetUser,
+		TargetID:   userID,
+		After:      map[string]interface{}{"email": email, "reason": reason},
+	})
+
+	if _, err := recordThrottledFailure(db, ipThrottleKey(c.ClientIP()), utils.GetLoginIPMaxFailures()); err != nil {
+		log.Printf("failed to record login attempt: %v", err)
+	}
+
+	locked, err := recordThrottledFailure(db, accountThrottleKey(email), utils.GetLoginMaxFailures())
+	if err != nil {
+		log.Printf("failed to record login attempt: %v", err)
+		return
+	}
+	if locked {
+		audit.Record(db, c, audit.Entry{
+			Action:     audit.ActionAccountLocked,
+			TargetType: audit.TargetUser,
+			TargetID:   userID,
+			After:      map[string]interface{}{"email": email, "locked_for": utils.GetLoginLockoutDuration().String()},
+		})
 	}
 }
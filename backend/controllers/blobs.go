@@ -0,0 +1,131 @@
+// controllers/blobs.go
+package controllers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+
+	"github.com/mfuadfakhruzzaki/project/backend/models"
+	"github.com/mfuadfakhruzzaki/project/backend/storage"
+	"github.com/mfuadfakhruzzaki/project/backend/utils"
+	"gorm.io/gorm"
+)
+
+// blobKey returns a new storage key for content with the given SHA-256 checksum. The random suffix
+// gives every blob row its own file, so deleting a released blob's file after commit can't remove
+// the file of a blob created for the same content in the meantime.
+func blobKey(checksum string) (string, error) {
+	suffix, err := utils.GenerateRandomToken(8)
+	if err != nil {
+		return "", err
+	}
+	return "blobs/" + checksum[:2] + "/" + checksum + "-" + suffix, nil
+}
+
+// lockContent serializes every upload and delete of the same content until the transaction ends,
+// so a blob can't be removed while another upload is starting to share it
+func lockContent(tx *gorm.DB, checksum string) error {
+	return tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", checksum).Error
+}
+
+// acquireBlob returns the blob holding the content and takes a reference on it. The content is
+// only read and stored when no blob has it yet, created reports whether that happened.
+func acquireBlob(tx *gorm.DB, ctx context.Context, store storage.Storage, checksum string, size int64, mimeType string, r io.Reader) (blob models.Blob, created bool, err error) {
+	if err := lockContent(tx, checksum); err != nil {
+		return blob, false, err
+	}
+
+	err = tx.Where("checksum = ?", checksum).First(&blob).Error
+	if err == nil {
+		err = tx.Model(&blob).Update("ref_count", gorm.Expr("ref_count + 1")).Error
+		return blob, false, err
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return blob, false, err
+	}
+
+	key, err := blobKey(checksum)
+	if err != nil {
+		return blob, false, err
+	}
+
+	blob = models.Blob{
+		Checksum:   checksum,
+		StorageKey: key,
+		Size:       size,
+		MimeType:   mimeType,
+		RefCount:   1,
+	}
+	if err := store.Put(ctx, blob.StorageKey, r, size, mimeType); err != nil {
+		return blob, false, err
+	}
+	if err := tx.Create(&blob).Error; err != nil {
+		deleteStoredFile(ctx, store, blob.StorageKey)
+		return blob, false, err
+	}
+	return blob, true, nil
+}
+
+// releaseBlob drops a reference to the blob and deletes the row once no asset uses it. It returns
+// the key of the file that became unused, which the caller deletes after the transaction commits
+// so a rollback never leaves the restored blob without its file.
+func releaseBlob(tx *gorm.DB, blobID uint) (string, error) {
+	var blob models.Blob
+	if err := tx.First(&blob, blobID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	if err := lockContent(tx, blob.Checksum); err != nil {
+		return "", err
+	}
+	// Read again, the count may have changed while waiting for the lock
+	if err := tx.First(&blob, blobID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	if blob.RefCount > 1 {
+		return "", tx.Model(&blob).Update("ref_count", gorm.Expr("ref_count - 1")).Error
+	}
+
+	if err := tx.Delete(&blob).Error; err != nil {
+		return "", err
+	}
+	return blob.StorageKey, nil
+}
+
+// releaseAssetFiles drops the file references of the assets being deleted in tx. It returns the keys
+// of the files nothing refers to anymore, to be deleted once the transaction has committed.
+// Assets uploaded before deduplication own their file.
+func releaseAssetFiles(tx *gorm.DB, assets []models.Asset) ([]string, error) {
+	var unused []string
+	for _, asset := range assets {
+		if asset.BlobID == nil {
+			unused = append(unused, asset.StorageKey)
+			continue
+		}
+
+		key, err := releaseBlob(tx, *asset.BlobID)
+		if err != nil {
+			return nil, err
+		}
+		if key != "" {
+			unused = append(unused, key)
+		}
+	}
+	return unused, nil
+}
+
+// deleteStoredFile removes a file no row refers to anymore. Failing only wastes space, so it is logged.
+func deleteStoredFile(ctx context.Context, store storage.Storage, key string) {
+	if err := store.Delete(ctx, key); err != nil {
+		log.Printf("failed to delete stored file %s: %v", key, err)
+	}
+}
@@ -0,0 +1,281 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mfuadfakhruzzaki/project/backend/audit"
+	"github.com/mfuadfakhruzzaki/project/backend/models"
+	"github.com/mfuadfakhruzzaki/project/backend/policies"
+	"github.com/mfuadfakhruzzaki/project/backend/utils"
+	"gorm.io/gorm"
+)
+
+// GetComments godoc
+// @Summary Mengambil daftar komentar tugas
+// @Description Mengambil daftar komentar pada tugas berdasarkan ID tugas dengan paginasi
+// @Tags Comments
+// @Security BearerAuth
+// @Param id path int true "Task ID"
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Page size" default(20)
+// @Produce json
+// @Success 200 {object} models.CommentListResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/tasks/{id}/comments [get]
+func GetComments(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		taskIDParam := c.Param("id")
+		taskID, err := strconv.Atoi(taskIDParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid task ID"})
+			return
+		}
+
+		var task models.Task
+		if err := db.First(&task, taskID).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Task not found"})
+			return
+		}
+
+		page, pageSize := utils.GetPagination(c)
+
+		var total int64
+		if err := db.Model(&models.Comment{}).Where("task_id = ?", taskID).Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to count comments"})
+			return
+		}
+
+		comments := []models.Comment{}
+		if err := db.Preload("User").
+			Where("task_id = ?", taskID).
+			Order("created_at ASC").
+			Offset((page - 1) * pageSize).
+			Limit(pageSize).
+			Find(&comments).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to fetch comments"})
+			return
+		}
+
+		c.JSON(http.StatusOK, models.CommentListResponse{
+			Data: comments,
+			Meta: models.PaginationMeta{
+				Page:       page,
+				PageSize:   pageSize,
+				Total:      total,
+				TotalPages: utils.TotalPages(total, pageSize),
+			},
+		})
+	}
+}
+
+// CreateComment godoc
+// @Summary Menambahkan komentar pada tugas
+// @Description Menambahkan komentar baru pada tugas berdasarkan ID tugas
+// @Tags Comments
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Task ID"
+// @Param comment body models.CreateCommentInput true "Create Comment"
+// @Success 201 {object} models.Comment
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/tasks/{id}/comments [post]
+func CreateComment(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		taskIDParam := c.Param("id")
+		taskID, err := strconv.Atoi(taskIDParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid task ID"})
+			return
+		}
+
+		var input models.CreateCommentInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		currentUserInterface, exists := c.Get("currentUser")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not found"})
+			return
+		}
+
+		user := currentUserInterface.(models.User)
+
+		var task models.Task
+		if err := db.First(&task, taskID).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Task not found"})
+			return
+		}
+
+		comment := models.Comment{
+			Content:   input.Content,
+			TaskID:    task.ID,
+			UserID:    user.ID,
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+		}
+
+		if err := db.Create(&comment).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to create comment"})
+			return
+		}
+
+		if err := db.Preload("User").First(&comment, comment.ID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to fetch created comment"})
+			return
+		}
+
+		audit.Record(db, c, audit.Entry{Action: audit.ActionCommentCreate, TargetType: audit.TargetComment, TargetID: comment.ID, After: comment})
+
+		c.JSON(http.StatusCreated, comment)
+	}
+}
+
+// UpdateComment godoc
+// @Summary Memperbarui komentar
+// @Description Memperbarui isi komentar. Hanya penulis komentar atau admin yang dapat mengubahnya
+// @Tags Comments
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Task ID"
+// @Param commentId path int true "Comment ID"
+// @Param comment body models.UpdateCommentInput true "Update Comment"
+// @Success 200 {object} models.Comment
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/tasks/{id}/comments/{commentId} [put]
+func UpdateComment(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		taskID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid task ID"})
+			return
+		}
+
+		commentID, err := strconv.Atoi(c.Param("commentId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid comment ID"})
+			return
+		}
+
+		var input models.UpdateCommentInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		currentUserInterface, exists := c.Get("currentUser")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not found"})
+			return
+		}
+
+		user := currentUserInterface.(models.User)
+
+		var comment models.Comment
+		if err := db.Where("task_id = ?", taskID).First(&comment, commentID).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Comment not found"})
+			return
+		}
+
+		// Only the author may edit, unless the user can moderate comments
+		if comment.UserID != user.ID && !policies.HasPermission(user, policies.PermCommentsModerate) {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "You can only edit your own comments"})
+			return
+		}
+
+		before := comment
+		now := time.Now()
+		comment.Content = input.Content
+		comment.EditedAt = &now
+		comment.UpdatedAt = now
+
+		if err := db.Save(&comment).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to update comment"})
+			return
+		}
+
+		if err := db.Preload("User").First(&comment, comment.ID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to fetch updated comment"})
+			return
+		}
+
+		audit.Record(db, c, audit.Entry{Action: audit.ActionCommentUpdate, TargetType: audit.TargetComment, TargetID: comment.ID, Before: before, After: comment})
+
+		c.JSON(http.StatusOK, comment)
+	}
+}
+
+// DeleteComment godoc
+// @Summary Menghapus komentar
+// @Description Menghapus komentar. Hanya penulis komentar atau admin yang dapat menghapusnya
+// @Tags Comments
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Task ID"
+// @Param commentId path int true "Comment ID"
+// @Success 200 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/tasks/{id}/comments/{commentId} [delete]
+func DeleteComment(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		taskID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid task ID"})
+			return
+		}
+
+		commentID, err := strconv.Atoi(c.Param("commentId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid comment ID"})
+			return
+		}
+
+		currentUserInterface, exists := c.Get("currentUser")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not found"})
+			return
+		}
+
+		user := currentUserInterface.(models.User)
+
+		var comment models.Comment
+		if err := db.Where("task_id = ?", taskID).First(&comment, commentID).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Comment not found"})
+			return
+		}
+
+		// Only the author may delete, unless the user can moderate comments
+		if comment.UserID != user.ID && !policies.HasPermission(user, policies.PermCommentsModerate) {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "You can only delete your own comments"})
+			return
+		}
+
+		if err := db.Delete(&comment).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to delete comment"})
+			return
+		}
+
+		audit.Record(db, c, audit.Entry{Action: audit.ActionCommentDelete, TargetType: audit.TargetComment, TargetID: comment.ID, Before: comment})
+
+		c.JSON(http.StatusOK, models.SuccessResponse{Message: "Comment deleted successfully"})
+	}
+}
@@ -3,9 +3,11 @@ package controllers
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 	"github.com/mfuadfakhruzzaki/project/backend/models"
+	"github.com/mfuadfakhruzzaki/project/backend/policies"
 	"gorm.io/gorm"
 )
 
@@ -14,8 +16,10 @@ import (
 // @Description Mengambil jumlah tugas berdasarkan status (todo, in_progress, completed) untuk pengguna yang sedang login
 // @Tags Dashboard
 // @Security BearerAuth
+// @Param project_id query int false "Filter by project ID"
 // @Produce json
 // @Success 200 {object} models.DashboardResponse
+// @Failure 400 {object} models.ErrorResponse
 // @Failure 401 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /dashboard [get]
@@ -29,11 +33,30 @@ func GetDashboard(db *gorm.DB) gin.HandlerFunc {
 
 		user := currentUserInterface.(models.User)
 
+		// Optionally restrict the counts to a single project
+		var projectID int
+		if projectIDParam := c.Query("project_id"); projectIDParam != "" {
+			id, err := strconv.Atoi(projectIDParam)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid project ID"})
+				return
+			}
+			projectID = id
+		}
+
+		scope := func(query *gorm.DB) *gorm.DB {
+			query = query.Scopes(policies.VisibleTasks(user))
+			if projectID != 0 {
+				query = query.Where("project_id = ?", projectID)
+			}
+			return query
+		}
+
 		var dashboard models.DashboardResponse
 
 		// Count todo
 		if err := db.Model(&models.Task{}).
-			Where("created_by = ? OR id IN (SELECT task_id FROM task_assignments WHERE user_id = ?)", user.ID, user.ID).
+			Scopes(scope).
 			Where("status = ?", "todo").
 			Count(&dashboard.Todo).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to count todo tasks"})
@@ -42,7 +65,7 @@ func GetDashboard(db *gorm.DB) gin.HandlerFunc {
 
 		// Count in_progress
 		if err := db.Model(&models.Task{}).
-			Where("created_by = ? OR id IN (SELECT task_id FROM task_assignments WHERE user_id = ?)", user.ID, user.ID).
+			Scopes(scope).
 			Where("status = ?", "in_progress").
 			Count(&dashboard.InProgress).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to count in_progress tasks"})
@@ -51,7 +74,7 @@ func GetDashboard(db *gorm.DB) gin.HandlerFunc {
 
 		// Count completed
 		if err := db.Model(&models.Task{}).
-			Where("created_by = ? OR id IN (SELECT task_id FROM task_assignments WHERE user_id = ?)", user.ID, user.ID).
+			Scopes(scope).
 			Where("status = ?", "completed").
 			Count(&dashboard.Completed).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to count completed tasks"})
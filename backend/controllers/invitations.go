@@ -0,0 +1,409 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mfuadfakhruzzaki/project/backend/audit"
+	"github.com/mfuadfakhruzzaki/project/backend/mailer"
+	"github.com/mfuadfakhruzzaki/project/backend/models"
+	"github.com/mfuadfakhruzzaki/project/backend/passwords"
+	"github.com/mfuadfakhruzzaki/project/backend/policies"
+	"github.com/mfuadfakhruzzaki/project/backend/utils"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+var errInvitationUsed = errors.New("invitation already used")
+
+// emailRegistered reports whether an account already uses the email, ignoring case
+func emailRegistered(db *gorm.DB, email string) (bool, error) {
+	var count int64
+	err := db.Model(&models.User{}).Where("LOWER(email) = LOWER(?)", email).Count(&count).Error
+	return count > 0, err
+}
+
+// sendInvitation stores the invitation with a new token and mails the link to the invitee
+func sendInvitation(db *gorm.DB, m mailer.Mailer, invitation *models.Invitation, inviter models.User, projectName string) error {
+	rawToken, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	invitation.TokenHash = utils.HashToken(rawToken)
+	invitation.InvitedByID = inviter.ID
+	invitation.ExpiresAt = time.Now().Add(utils.GetInvitationTTL())
+	invitation.CreatedAt = time.Now()
+	if err := db.Create(invitation).Error; err != nil {
+		return err
+	}
+
+	subject := "You have been invited"
+	intro := inviter.Username + " invited you to create an account."
+	if projectName != "" {
+		subject = "You have been invited to " + projectName
+		intro = inviter.Username + " invited you to join the project " + projectName + "."
+	}
+
+	link := utils.GetAppURL() + "/accept-invitation?token=" + rawToken
+	return m.Send(mailer.Message{
+		To:      invitation.Email,
+		Subject: subject,
+		Body: "Hi,\n\n" + intro + " Open the link below to choose a username and password. It expires in " +
+			utils.GetInvitationTTL().String() + ".\n\n" + link + "\n",
+	})
+}
+
+// CreateInvitation godoc
+// @Summary Mengundang pengguna baru
+// @Description Mengirim undangan melalui email untuk membuat akun dengan role yang ditentukan (default role pengguna biasa)
+// @Tags Admin - Invitations
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param invitation body models.CreateInvitationInput true "Invitation"
+// @Success 201 {object} models.Invitation
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/admin/invitations [post]
+func CreateInvitation(db *gorm.DB, m mailer.Mailer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if utils.GetRegistrationMode() == utils.RegistrationDisabled {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "Registration is disabled"})
+			return
+		}
+
+		var input models.CreateInvitationInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		currentUserInterface, exists := c.Get("currentUser")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not found"})
+			return
+		}
+
+		currentUser := currentUserInterface.(models.User)
+
+		registered, err := emailRegistered(db, input.Email)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to create invitation"})
+			return
+		}
+		if registered {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Email already registered"})
+			return
+		}
+
+		var role models.Role
+		roleQuery := db.Where("name = ?", policies.DefaultRoleName)
+		if input.RoleID != 0 {
+			roleQuery = db.Where("id = ?", input.RoleID)
+		}
+		if err := roleQuery.First(&role).Error; err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Role not found"})
+			return
+		}
+
+		invitation := models.Invitation{Email: input.Email, RoleID: role.ID}
+		if err := sendInvitation(db, m, &invitation, currentUser, ""); err != nil {
+			log.Printf("failed to send invitation: %v", err)
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to send invitation"})
+			return
+		}
+
+		audit.Record(db, c, audit.Entry{
+			Action:     audit.ActionInvitationCreate,
+			TargetType: audit.TargetInvitation,
+			TargetID:   invitation.ID,
+			After:      map[string]interface{}{"email": invitation.Email, "role_id": role.ID},
+		})
+
+		invitation.Role = role
+		c.JSON(http.StatusCreated, invitation)
+	}
+}
+
+// CreateProjectInvitation godoc
+// @Summary Mengundang pengguna baru ke proyek
+// @Description Mengirim undangan melalui email kepada orang yang belum memiliki akun. Setelah menerima undangan, pengguna menjadi anggota proyek. Hanya pemilik atau admin
+// @Tags Projects
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param invitation body models.CreateProjectInvitationInput true "Invitation"
+// @Success 201 {object} models.Invitation
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/projects/{id}/invitations [post]
+func CreateProjectInvitation(db *gorm.DB, m mailer.Mailer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid project ID"})
+			return
+		}
+
+		if utils.GetRegistrationMode() == utils.RegistrationDisabled {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "Registration is disabled"})
+			return
+		}
+
+		var input models.CreateProjectInvitationInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		currentUserInterface, exists := c.Get("currentUser")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not found"})
+			return
+		}
+
+		currentUser := currentUserInterface.(models.User)
+
+		var project models.Project
+		if err := db.First(&project, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Project not found"})
+			return
+		}
+
+		// Existing users are added directly through the members endpoint
+		registered, err := emailRegistered(db, input.Email)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to create invitation"})
+			return
+		}
+		if registered {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Email already registered, add the user as a member instead"})
+			return
+		}
+
+		// Project owners can only invite regular users
+		var role models.Role
+		if err := db.Where("name = ?", policies.DefaultRoleName).First(&role).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Default role not found"})
+			return
+		}
+
+		invitation := models.Invitation{Email: input.Email, RoleID: role.ID, ProjectID: &project.ID}
+		if err := sendInvitation(db, m, &invitation, currentUser, project.Name); err != nil {
+			log.Printf("failed to send invitation: %v", err)
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to send invitation"})
+			return
+		}
+
+		audit.Record(db, c, audit.Entry{
+			Action:     audit.ActionInvitationCreate,
+			TargetType: audit.TargetInvitation,
+			TargetID:   invitation.ID,
+			After:      map[string]interface{}{"email": invitation.Email, "role_id": role.ID, "project_id": project.ID},
+		})
+
+		invitation.Role = role
+		c.JSON(http.StatusCreated, invitation)
+	}
+}
+
+// GetInvitations godoc
+// @Summary Mengambil daftar undangan
+// @Description Mengambil undangan yang belum diterima, dicabut, atau kedaluwarsa
+// @Tags Admin - Invitations
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} models.Invitation
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/admin/invitations [get]
+func GetInvitations(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		invitations := []models.Invitation{}
+		if err := db.Preload("Role").
+			Where("accepted_at IS NULL AND revoked_at IS NULL AND expires_at > ?", time.Now()).
+			Order("created_at DESC").Find(&invitations).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to retrieve invitations"})
+			return
+		}
+
+		c.JSON(http.StatusOK, invitations)
+	}
+}
+
+// RevokeInvitation godoc
+// @Summary Mencabut undangan
+// @Description Mencabut undangan yang belum diterima sehingga tautannya tidak dapat digunakan lagi
+// @Tags Admin - Invitations
+// @Security BearerAuth
+// @Param id path int true "Invitation ID"
+// @Produce json
+// @Success 200 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/admin/invitations/{id} [delete]
+func RevokeInvitation(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idParam := c.Param("id")
+		id, err := strconv.Atoi(idParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid invitation ID"})
+			return
+		}
+
+		result := db.Model(&models.Invitation{}).
+			Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", id).
+			Update("revoked_at", time.Now())
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to revoke invitation"})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Invitation not found"})
+			return
+		}
+
+		audit.Record(db, c, audit.Entry{Action: audit.ActionInvitationRevoke, TargetType: audit.TargetInvitation, TargetID: uint(id)})
+
+		c.JSON(http.StatusOK, models.SuccessResponse{Message: "Invitation revoked successfully"})
+	}
+}
+
+// AcceptInvitation godoc
+// @Summary Menerima undangan
+// @Description Membuat akun dari undangan dengan role yang telah ditentukan. Email dianggap terverifikasi dan pengguna ditambahkan ke proyek dari semua undangan yang masih berlaku untuk email tersebut
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param input body models.AcceptInvitationInput true "Accept Invitation"
+// @Success 201 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /invitations/accept [post]
+func AcceptInvitation(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if utils.GetRegistrationMode() == utils.RegistrationDisabled {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "Registration is disabled"})
+			return
+		}
+
+		var input models.AcceptInvitationInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		var invitation models.Invitation
+		if err := db.Where("token_hash = ? AND accepted_at IS NULL AND revoked_at IS NULL", utils.HashToken(input.Token)).
+			First(&invitation).Error; err != nil || time.Now().After(invitation.ExpiresAt) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid or expired invitation"})
+			return
+		}
+
+		registered, err := emailRegistered(db, invitation.Email)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to accept invitation"})
+			return
+		}
+		if registered {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Email already registered"})
+			return
+		}
+
+		if err := passwords.Validate(input.Password, input.Username, invitation.Email); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to hash password"})
+			return
+		}
+
+		now := time.Now()
+		// The invitation link was delivered to this address, so it counts as verified
+		user := models.User{
+			Username:        input.Username,
+			Email:           invitation.Email,
+			Password:        string(hashedPassword),
+			IsActive:        true,
+			EmailVerifiedAt: &now,
+			RoleID:          invitation.RoleID,
+			CreatedAt:       now,
+			UpdatedAt:       now,
+		}
+
+		var projectIDs []uint
+		err = db.Transaction(func(tx *gorm.DB) error {
+			// Claim the invitation first so the same link can't create two accounts
+			result := tx.Model(&models.Invitation{}).
+				Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", invitation.ID).
+				Update("accepted_at", now)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errInvitationUsed
+			}
+
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+
+			// Project invitations from other owners to the same address are honoured as well
+			var pending []models.Invitation
+			if err := tx.Where("LOWER(email) = LOWER(?) AND revoked_at IS NULL AND expires_at > ? AND (id = ? OR accepted_at IS NULL)",
+				invitation.Email, now, invitation.ID).Find(&pending).Error; err != nil {
+				return err
+			}
+
+			for _, p := range pending {
+				if p.ProjectID != nil {
+					projectIDs = append(projectIDs, *p.ProjectID)
+					member := models.ProjectMember{ProjectID: *p.ProjectID, UserID: user.ID}
+					if err := tx.Where(member).Attrs(models.ProjectMember{CreatedAt: now}).FirstOrCreate(&member).Error; err != nil {
+						return err
+					}
+				}
+				if p.ID != invitation.ID {
+					if err := tx.Model(&p).Update("accepted_at", now).Error; err != nil {
+						return err
+					}
+				}
+			}
+			return nil
+		})
+		if errors.Is(err, errInvitationUsed) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid or expired invitation"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to accept invitation"})
+			return
+		}
+
+		audit.Record(db, c, audit.Entry{ActorID: &user.ID, Action: audit.ActionRegister, TargetType: audit.TargetUser, TargetID: user.ID, After: user})
+		audit.Record(db, c, audit.Entry{
+			ActorID:    &user.ID,
+			Action:     audit.ActionInvitationAccept,
+			TargetType: audit.TargetInvitation,
+			TargetID:   invitation.ID,
+			After:      map[string]interface{}{"user_id": user.ID, "project_ids": projectIDs},
+		})
+
+		c.JSON(http.StatusCreated, models.SuccessResponse{Message: "Account created successfully, you can now log in"})
+	}
+}
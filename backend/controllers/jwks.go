@@ -0,0 +1,32 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mfuadfakhruzzaki/project/backend/models"
+	"github.com/mfuadfakhruzzaki/project/backend/utils"
+)
+
+// GetJWKS godoc
+// @Summary Mengambil public key JWT
+// @Description Mengambil public key (JWKS) untuk memverifikasi token yang diterbitkan layanan ini. Key lama tetap tercantum selama masa rotasi
+// @Description Access token memiliki header typ "at+jwt", klaim iss sesuai JWT_ISSUER dan aud sesuai JWT_AUDIENCE. Layanan lain harus memeriksa ketiganya karena token lain (challenge 2FA, impersonation) ditandatangani dengan key yang sama
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} utils.JWKSet
+// @Failure 500 {object} models.ErrorResponse
+// @Router /.well-known/jwks.json [get]
+func GetJWKS() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		set, err := utils.GetJWKS()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to load signing keys"})
+			return
+		}
+
+		// Verifiers may cache the keys briefly, rotation keeps the old key published long enough
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, set)
+	}
+}
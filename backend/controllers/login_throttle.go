@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mfuadfakhruzzaki/project/backend/models"
+	"github.com/mfuadfakhruzzaki/project/backend/utils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Accounts are keyed by email rather than user ID so unknown emails are throttled
+// exactly like existing ones and the responses don't reveal which accounts exist
+func accountThrottleKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// loginThrottleWait returns how long the client has to wait before the next attempt is allowed
+func loginThrottleWait(db *gorm.DB, key string) (time.Duration, error) {
+	var throttle models.LoginThrottle
+	err := db.Where("key = ?", key).Limit(1).Find(&throttle).Error
+	if err != nil || throttle.ID == 0 {
+		return 0, err
+	}
+
+	now := time.Now()
+	if throttle.LockedUntil != nil && throttle.LockedUntil.After(now) {
+		return throttle.LockedUntil.Sub(now), nil
+	}
+
+	// Counters expire after a quiet period
+	if now.Sub(throttle.LastFailureAt) > utils.GetLoginLockoutDuration() {
+		return 0, nil
+	}
+
+	return time.Until(throttle.LastFailureAt.Add(loginBackoff(throttle.Failures))), nil
+}
+
+// loginBackoff doubles the delay with every failure, capped at the lockout duration
+func loginBackoff(failures int) time.Duration {
+	backoff := utils.GetLoginBackoffBase()
+	for i := 1; i < failures; i++ {
+		backoff *= 2
+		if backoff >= utils.GetLoginLockoutDuration() {
+			return utils.GetLoginLockoutDuration()
+		}
+	}
+	return backoff
+}
+
+// recordThrottledFailure counts a failed attempt against the key and locks it once maxFailures
+// is reached. It reports whether this failure caused a lockout.
+func recordThrottledFailure(db *gorm.DB, key string, maxFailures int) (bool, error) {
+	now := time.Now()
+	windowStart := now.Add(-utils.GetLoginLockoutDuration())
+
+	// Upsert so concurrent attempts can't lose increments
+	throttle := models.LoginThrottle{Key: key, Failures: 1, LastFailureAt: now}
+	if err := db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "key"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"failures":        gorm.Expr("CASE WHEN login_throttles.last_failure_at < ? THEN 1 ELSE login_throttles.failures + 1 END", windowStart),
+			"last_failure_at": now,
+		}),
+	}).Create(&throttle).Error; err != nil {
+		return false, err
+	}
+
+	if err := db.Where("key = ?", key).First(&throttle).Error; err != nil {
+		return false, err
+	}
+	if throttle.Failures < maxFailures {
+		return false, nil
+	}
+
+	lockedUntil := now.Add(utils.GetLoginLockoutDuration())
+	if err := db.Model(&throttle).Update("locked_until", lockedUntil).Error; err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// clearLoginThrottle forgets the failures counted against the key
+func clearLoginThrottle(db *gorm.DB, key string) error {
+	return db.Where("key = ?", key).Delete(&models.LoginThrottle{}).Error
+}
+
+// checkLoginThrottle answers 429 with Retry-After if the IP or account must wait. It returns false if the request was rejected.
+func checkLoginThrottle(db *gorm.DB, c *gin.Context, email string) bool {
+	for _, key := range []string{ipThrottleKey(c.ClientIP()), accountThrottleKey(email)} {
+		wait, err := loginThrottleWait(db, key)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to check login attempts"})
+			return false
+		}
+		if wait > 0 {
+			c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			c.JSON(http.StatusTooManyRequests, models.ErrorResponse{Error: "Too many failed login attempts, please try again later"})
+			return false
+		}
+	}
+	return true
+}
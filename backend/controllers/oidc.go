@@ -0,0 +1,354 @@
+package controllers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mfuadfakhruzzaki/project/backend/audit"
+	"github.com/mfuadfakhruzzaki/project/backend/models"
+	"github.com/mfuadfakhruzzaki/project/backend/policies"
+	"github.com/mfuadfakhruzzaki/project/backend/sso"
+	"github.com/mfuadfakhruzzaki/project/backend/utils"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	oidcStateCookie = "oidc_state"
+	oidcStateTTL    = 10 * time.Minute
+)
+
+var (
+	errOIDCEmailNotVerified   = errors.New("identity provider email is not verified")
+	errOIDCRegistrationClosed = errors.New("registration is closed")
+	errOIDCAccountUnverified  = errors.New("local account email is not verified")
+	errOIDCUserInactive       = errors.New("user is inactive")
+)
+
+// OIDCLogin godoc
+// @Summary Login melalui identity provider (OIDC)
+// @Description Mengarahkan browser ke halaman login identity provider menggunakan authorization code flow dengan PKCE
+// @Tags Auth
+// @Success 302
+// @Failure 500 {object} models.ErrorResponse
+// @Router /oidc/login [get]
+func OIDCLogin(db *gorm.DB, idp *sso.Provider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		state, err := utils.GenerateRandomToken(32)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to start login"})
+			return
+		}
+		nonce, err := utils.GenerateRandomToken(32)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to start login"})
+			return
+		}
+		verifier := sso.GenerateVerifier()
+
+		// Abandoned logins are cleaned up whenever a new one starts
+		if err := db.Where("expires_at < ?", time.Now()).Delete(&models.OIDCLoginState{}).Error; err != nil {
+			log.Printf("failed to delete expired OIDC login states: %v", err)
+		}
+
+		loginState := models.OIDCLoginState{
+			StateHash:    utils.HashToken(state),
+			Nonce:        nonce,
+			CodeVerifier: verifier,
+			ExpiresAt:    time.Now().Add(oidcStateTTL),
+			CreatedAt:    time.Now(),
+		}
+		if err := db.Create(&loginState).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to start login"})
+			return
+		}
+
+		// The cookie ties the callback to the browser that started the login
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(oidcStateCookie, state, int(oidcStateTTL.Seconds()), "/oidc", "", gin.Mode() == gin.ReleaseMode, true)
+
+		c.Redirect(http.StatusFound, idp.AuthCodeURL(state, nonce, verifier))
+	}
+}
+
+// OIDCCallback godoc
+// @Summary Callback login identity provider (OIDC)
+// @Description Menukar authorization code dari identity provider dengan token. Pengguna ditautkan berdasarkan email yang terverifikasi di identity provider dan di akun lokal, atau dibuat jika belum ada, dan role disesuaikan dengan grup di identity provider
+// @Description Jika 2FA aktif dan identity provider tidak melaporkan MFA (amr/acr), mengembalikan challenge token untuk /login/2fa (lihat models.TwoFactorChallengeResponse)
+// @Tags Auth
+// @Produce json
+// @Param code query string true "Authorization code"
+// @Param state query string true "State"
+// @Success 200 {object} models.TokenResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /oidc/callback [get]
+func OIDCCallback(db *gorm.DB, idp *sso.Provider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if idpError := c.Query("error"); idpError != "" {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "Identity provider login failed: " + idpError})
+			return
+		}
+
+		state := c.Query("state")
+		code := c.Query("code")
+		cookieState, _ := c.Cookie(oidcStateCookie)
+		c.SetCookie(oidcStateCookie, "", -1, "/oidc", "", gin.Mode() == gin.ReleaseMode, true)
+		if state == "" || code == "" || subtle.ConstantTimeCompare([]byte(state), []byte(cookieState)) != 1 {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid login state"})
+			return
+		}
+
+		// States are single use, deleting them first keeps a replayed callback from getting through
+		var loginState models.OIDCLoginState
+		if err := db.Where("state_hash = ?", utils.HashToken(state)).First(&loginState).Error; err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid login state"})
+			return
+		}
+		result := db.Delete(&loginState)
+		if result.Error != nil || result.RowsAffected == 0 || time.Now().After(loginState.ExpiresAt) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid login state"})
+			return
+		}
+
+		identity, err := idp.Exchange(c.Request.Context(), code, loginState.CodeVerifier, loginState.Nonce)
+		if err != nil {
+			log.Printf("OIDC login failed: %v", err)
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "Failed to verify identity provider login"})
+			return
+		}
+
+		user, err := resolveOIDCUser(db, c, identity)
+		if errors.Is(err, errOIDCEmailNotVerified) {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "Email address is not verified by the identity provider"})
+			return
+		}
+		if errors.Is(err, errOIDCRegistrationClosed) {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "No account exists for this email"})
+			return
+		}
+		if errors.Is(err, errOIDCAccountUnverified) {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "An account with this email exists but is not verified, verify the email before signing in with the identity provider"})
+			return
+		}
+		if errors.Is(err, errOIDCUserInactive) {
+			recordLoginFailure(db, c, user.ID, user.Email, "inactive")
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User is inactive"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to sign in user"})
+			return
+		}
+
+		if err := syncOIDCRole(db, c, idp, &user, identity.Groups); err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to sign in user"})
+			return
+		}
+
+		// Local 2FA still applies unless the identity provider reports that it checked a second factor
+		if user.TOTPEnabled && !identity.MFA {
+			challenge, err := utils.GenerateTwoFactorChallenge(user.ID, user.TokenVersion)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to generate token"})
+				return
+			}
+			c.JSON(http.StatusOK, models.TwoFactorChallengeResponse{TwoFactorRequired: true, ChallengeToken: challenge})
+			return
+		}
+
+		tokens, _, err := issueTokens(db, c, user, "")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to generate token"})
+			return
+		}
+
+		audit.Record(db, c, audit.Entry{ActorID: &user.ID, Action: audit.ActionLogin, TargetType: audit.TargetUser, TargetID: user.ID})
+
+		c.JSON(http.StatusOK, tokens)
+	}
+}
+
+// resolveOIDCUser returns the active user linked to the identity. An unlinked identity is linked to
+// the user with the same verified email, or a new user is provisioned. Inactive users are returned
+// with errOIDCUserInactive and nothing is linked to them.
+func resolveOIDCUser(db *gorm.DB, c *gin.Context, identity *sso.Identity) (models.User, error) {
+	var user models.User
+
+	var link models.UserIdentity
+	if err := db.Where("issuer = ? AND subject = ?", identity.Issuer, identity.Subject).Limit(1).Find(&link).Error; err != nil {
+		return user, err
+	}
+	if link.ID != 0 {
+		if err := db.Preload("Role").First(&user, link.UserID).Error; err != nil {
+			return user, err
+		}
+		if !user.IsActive {
+			return user, errOIDCUserInactive
+		}
+		return user, nil
+	}
+
+	// Linking by email is only safe when the provider vouches for the address
+	if identity.Email == "" || !identity.EmailVerified {
+		return user, errOIDCEmailNotVerified
+	}
+
+	created := false
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("LOWER(email) = LOWER(?)", identity.Email).Limit(1).Find(&user).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if user.ID == 0 {
+			// Outside open registration the identity provider can only sign in existing users
+			if utils.GetRegistrationMode() != utils.RegistrationOpen {
+				return errOIDCRegistrationClosed
+			}
+
+			var role models.Role
+			if err := tx.Where("name = ?", policies.DefaultRoleName).First(&role).Error; err != nil {
+				return err
+			}
+
+			// Nobody knows this password, the user can still set one through the password reset
+			randomPassword, err := utils.GenerateRandomToken(32)
+			if err != nil {
+				return err
+			}
+			hashedPassword, err := bcrypt.GenerateFromPassword([]byte(randomPassword), bcrypt.DefaultCost)
+			if err != nil {
+				return err
+			}
+
+			user = models.User{
+				Username:        oidcUsername(identity),
+				Email:           identity.Email,
+				Password:        string(hashedPassword),
+				IsActive:        true,
+				EmailVerifiedAt: &now,
+				RoleID:          role.ID,
+				CreatedAt:       now,
+				UpdatedAt:       now,
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			created = true
+		} else if !user.IsActive {
+			return errOIDCUserInactive
+		} else if user.EmailVerifiedAt == nil {
+			// Anyone can register an address without owning it, linking would hand the owner's
+			// identity to an account whose password may belong to someone else
+			return errOIDCAccountUnverified
+		}
+
+		return tx.Create(&models.UserIdentity{
+			UserID:    user.ID,
+			Issuer:    identity.Issuer,
+			Subject:   identity.Subject,
+			Email:     identity.Email,
+			CreatedAt: now,
+		}).Error
+	})
+	if err != nil {
+		return user, err
+	}
+
+	if created {
+		audit.Record(db, c, audit.Entry{ActorID: &user.ID, Action: audit.ActionRegister, TargetType: audit.TargetUser, TargetID: user.ID, After: user})
+	}
+	audit.Record(db, c, audit.Entry{
+		ActorID:    &user.ID,
+		Action:     audit.ActionIdentityLink,
+		TargetType: audit.TargetUser,
+		TargetID:   user.ID,
+		After:      map[string]interface{}{"issuer": identity.Issuer, "subject": identity.Subject},
+	})
+
+	if err := db.Preload("Role").First(&user, user.ID).Error; err != nil {
+		return user, err
+	}
+	return user, nil
+}
+
+// oidcUsername picks a display name for a provisioned user
+func oidcUsername(identity *sso.Identity) string {
+	switch {
+	case identity.Username != "":
+		return identity.Username
+	case identity.Name != "":
+		return identity.Name
+	default:
+		username, _, _ := strings.Cut(identity.Email, "@")
+		return username
+	}
+}
+
+// syncOIDCRole gives the user the role mapped to their identity provider groups, or the default role
+// if no group matches. Without a configured mapping roles are managed locally and left alone.
+func syncOIDCRole(db *gorm.DB, c *gin.Context, idp *sso.Provider, user *models.User, groups []string) error {
+	if len(idp.RoleMappings) == 0 {
+		return nil
+	}
+
+	roleName := idp.RoleFor(groups)
+	if roleName == "" {
+		roleName = policies.DefaultRoleName
+	}
+
+	var role models.Role
+	if err := db.Preload("Permissions").Where("name = ?", roleName).First(&role).Error; err != nil {
+		log.Printf("OIDC role mapping refers to unknown role %q", roleName)
+		return nil
+	}
+	if user.RoleID == role.ID {
+		return nil
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if !policies.HasPermission(models.User{Role: role}, policies.PermUsersManage) {
+			if err := ensureNotLastAdmin(tx, user.ID); err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(&models.User{ID: user.ID}).Update("role_id", role.ID).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.RoleChange{
+			UserID:    user.ID,
+			OldRoleID: user.RoleID,
+			NewRoleID: role.ID,
+			CreatedAt: time.Now(),
+		}).Error
+	})
+	if errors.Is(err, errLastAdmin) {
+		log.Printf("kept role of user %d, the identity provider would demote the last admin", user.ID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	audit.Record(db, c, audit.Entry{
+		Action:     audit.ActionUserRoleUpdate,
+		TargetType: audit.TargetUser,
+		TargetID:   user.ID,
+		Before:     map[string]interface{}{"role_id": user.RoleID},
+		After:      map[string]interface{}{"role_id": role.ID},
+	})
+
+	user.RoleID = role.ID
+	user.Role = role
+	return nil
+}
@@ -0,0 +1,195 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mfuadfakhruzzaki/project/backend/audit"
+	"github.com/mfuadfakhruzzaki/project/backend/mailer"
+	"github.com/mfuadfakhruzzaki/project/backend/models"
+	"github.com/mfuadfakhruzzaki/project/backend/passwords"
+	"github.com/mfuadfakhruzzaki/project/backend/utils"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// errResetRequestedRecently is returned when the user was sent a reset link within the resend interval
+var errResetRequestedRecently = errors.New("password reset requested recently")
+
+// sendPasswordResetEmail issues a new reset token for the user and mails it. Unused tokens are discarded,
+// and nothing is sent if the last token is younger than PASSWORD_RESET_RESEND_INTERVAL.
+func sendPasswordResetEmail(db *gorm.DB, m mailer.Mailer, user models.User) error {
+	rawToken, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	resetToken := models.PasswordResetToken{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(rawToken),
+		ExpiresAt: time.Now().Add(utils.GetPasswordResetTokenTTL()),
+		CreatedAt: time.Now(),
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Locking the user keeps concurrent requests from both passing the cooldown
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&models.User{}, user.ID).Error; err != nil {
+			return err
+		}
+
+		var lastToken models.PasswordResetToken
+		if err := tx.Where("user_id = ?", user.ID).Order("created_at DESC").Limit(1).Find(&lastToken).Error; err != nil {
+			return err
+		}
+		if lastToken.ID != 0 && time.Since(lastToken.CreatedAt) < utils.GetPasswordResetResendInterval() {
+			return errResetRequestedRecently
+		}
+
+		// Only the most recently requested token stays usable
+		if err := tx.Where("user_id = ? AND used_at IS NULL", user.ID).Delete(&models.PasswordResetToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&resetToken).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	link := utils.GetAppURL() + "/reset-password?token=" + rawToken
+	return m.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: "Hi " + user.Username + ",\n\n" +
+			"Use the link below to choose a new password. It expires in " + utils.GetPasswordResetTokenTTL().String() + ".\n\n" +
+			link + "\n\n" +
+			"If you did not request a password reset, you can ignore this email.\n",
+	})
+}
+
+// ForgotPassword godoc
+// @Summary Meminta reset password
+// @Description Mengirim email berisi tautan reset password jika email terdaftar. Respons dan waktu respons selalu sama agar keberadaan akun tidak bocor
+// @Description Email dikirim di latar belakang, dan paling banyak satu tautan per akun dikirim dalam PASSWORD_RESET_RESEND_INTERVAL
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param input body models.ForgotPasswordInput true "Forgot Password Input"
+// @Success 200 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Router /password/forgot [post]
+func ForgotPassword(db *gorm.DB, m mailer.Mailer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input models.ForgotPasswordInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		response := models.SuccessResponse{Message: "If the email is registered, a password reset link has been sent"}
+
+		var user models.User
+		if err := db.Where("email = ?", input.Email).First(&user).Error; err != nil || !user.IsActive {
+			c.JSON(http.StatusOK, response)
+			return
+		}
+
+		// Issuing the token and talking to the mail server take time only known accounts would spend,
+		// so it happens after responding. Failures are logged, the response must not depend on the account.
+		go func() {
+			err := sendPasswordResetEmail(db, m, user)
+			if err != nil && !errors.Is(err, errResetRequestedRecently) {
+				log.Printf("failed to send password reset email: %v", err)
+			}
+		}()
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// ResetPassword godoc
+// @Summary Reset password
+// @Description Mengganti password menggunakan token reset. Token hanya dapat digunakan sekali dan semua sesi serta personal access token akan dicabut
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param input body models.ResetPasswordInput true "Reset Password Input"
+// @Success 200 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /password/reset [post]
+func ResetPassword(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input models.ResetPasswordInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		var resetToken models.PasswordResetToken
+		if err := db.Where("token_hash = ? AND used_at IS NULL", utils.HashToken(input.Token)).First(&resetToken).Error; err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid or expired reset token"})
+			return
+		}
+
+		if time.Now().After(resetToken.ExpiresAt) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid or expired reset token"})
+			return
+		}
+
+		var user models.User
+		if err := db.First(&user, resetToken.UserID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid or expired reset token"})
+			return
+		}
+
+		if err := passwords.Validate(input.Password, user.Username, user.Email); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to hash password"})
+			return
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			// Mark the token as used first so concurrent requests can't both succeed
+			result := tx.Model(&models.PasswordResetToken{}).
+				Where("id = ? AND used_at IS NULL", resetToken.ID).
+				Update("used_at", time.Now())
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return gorm.ErrRecordNotFound
+			}
+
+			return tx.Model(&models.User{}).Where("id = ?", resetToken.UserID).Updates(map[string]interface{}{
+				"password":   string(hashedPassword),
+				"updated_at": time.Now(),
+			}).Error
+		})
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid or expired reset token"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to reset password"})
+			return
+		}
+
+		if err := revokeAllSessions(db, resetToken.UserID); err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to revoke sessions"})
+			return
+		}
+
+		audit.Record(db, c, audit.Entry{ActorID: &resetToken.UserID, Action: audit.ActionPasswordReset, TargetType: audit.TargetUser, TargetID: resetToken.UserID})
+
+		c.JSON(http.StatusOK, models.SuccessResponse{Message: "Password has been reset successfully"})
+	}
+}
@@ -0,0 +1,200 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mfuadfakhruzzaki/project/backend/audit"
+	"github.com/mfuadfakhruzzaki/project/backend/models"
+	"github.com/mfuadfakhruzzaki/project/backend/policies"
+	"github.com/mfuadfakhruzzaki/project/backend/utils"
+	"gorm.io/gorm"
+)
+
+const defaultPersonalAccessTokenDays = 30
+
+func toPersonalAccessTokenResponse(token models.PersonalAccessToken) models.PersonalAccessTokenResponse {
+	return models.PersonalAccessTokenResponse{
+		ID:         token.ID,
+		Name:       token.Name,
+		Scopes:     strings.Fields(token.Scopes),
+		ExpiresAt:  token.ExpiresAt,
+		LastUsedAt: token.LastUsedAt,
+		CreatedAt:  token.CreatedAt,
+	}
+}
+
+// GetPersonalAccessTokens godoc
+// @Summary Mengambil daftar personal access token
+// @Description Mengambil personal access token milik pengguna yang sedang login yang belum dicabut. Nilai token tidak ditampilkan
+// @Tags Personal Access Tokens
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} models.PersonalAccessTokenResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /profile/tokens [get]
+func GetPersonalAccessTokens(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		currentUserInterface, exists := c.Get("currentUser")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not found"})
+			return
+		}
+
+		user := currentUserInterface.(models.User)
+
+		var tokens []models.PersonalAccessToken
+		if err := db.Where("user_id = ? AND revoked_at IS NULL", user.ID).Order("created_at DESC").Find(&tokens).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to retrieve tokens"})
+			return
+		}
+
+		response := make([]models.PersonalAccessTokenResponse, 0, len(tokens))
+		for _, token := range tokens {
+			response = append(response, toPersonalAccessTokenResponse(token))
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// CreatePersonalAccessToken godoc
+// @Summary Membuat personal access token
+// @Description Membuat personal access token dengan nama, scope, dan masa berlaku (default 30 hari, maksimal 365 hari). Token hanya ditampilkan sekali
+// @Tags Personal Access Tokens
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param input body models.CreatePersonalAccessTokenInput true "Create Token Input"
+// @Success 201 {object} models.PersonalAccessTokenCreatedResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /profile/tokens [post]
+func CreatePersonalAccessToken(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input models.CreatePersonalAccessTokenInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		currentUserInterface, exists := c.Get("currentUser")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not found"})
+			return
+		}
+
+		user := currentUserInterface.(models.User)
+
+		scopes := make([]string, 0, len(input.Scopes))
+		for _, scope := range input.Scopes {
+			if !policies.IsValidScope(scope) {
+				c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Unknown scope: " + scope})
+				return
+			}
+			if policies.HasScope(scopes, policies.Scope(scope)) {
+				continue
+			}
+			scopes = append(scopes, scope)
+		}
+
+		if policies.HasScope(scopes, policies.ScopeAdmin) &&
+			!policies.HasPermission(user, policies.PermUsersManage) && !policies.HasPermission(user, policies.PermRolesManage) {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "Only admins can create tokens with the admin scope"})
+			return
+		}
+
+		days := input.ExpiresInDays
+		if days == 0 {
+			days = defaultPersonalAccessTokenDays
+		}
+
+		rawToken, err := utils.GenerateRandomToken(32)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to generate token"})
+			return
+		}
+		rawToken = utils.PersonalAccessTokenPrefix + rawToken
+
+		token := models.PersonalAccessToken{
+			UserID:    user.ID,
+			Name:      input.Name,
+			TokenHash: utils.HashToken(rawToken),
+			Scopes:    strings.Join(scopes, " "),
+			ExpiresAt: time.Now().AddDate(0, 0, days),
+			CreatedAt: time.Now(),
+		}
+		if err := db.Create(&token).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to create token"})
+			return
+		}
+
+		audit.Record(db, c, audit.Entry{
+			Action:     audit.ActionTokenCreate,
+			TargetType: audit.TargetPersonalAccessToken,
+			TargetID:   token.ID,
+			After:      toPersonalAccessTokenResponse(token),
+		})
+
+		c.JSON(http.StatusCreated, models.PersonalAccessTokenCreatedResponse{
+			Token: rawToken,
+			Info:  toPersonalAccessTokenResponse(token),
+		})
+	}
+}
+
+// RevokePersonalAccessToken godoc
+// @Summary Mencabut personal access token
+// @Description Mencabut personal access token milik pengguna yang sedang login
+// @Tags Personal Access Tokens
+// @Security BearerAuth
+// @Param id path int true "Token ID"
+// @Produce json
+// @Success 200 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /profile/tokens/{id} [delete]
+func RevokePersonalAccessToken(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idParam := c.Param("id")
+		id, err := strconv.Atoi(idParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid token ID"})
+			return
+		}
+
+		currentUserInterface, exists := c.Get("currentUser")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not found"})
+			return
+		}
+
+		user := currentUserInterface.(models.User)
+
+		result := db.Model(&models.PersonalAccessToken{}).
+			Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, user.ID).
+			Update("revoked_at", time.Now())
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to revoke token"})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Token not found"})
+			return
+		}
+
+		audit.Record(db, c, audit.Entry{Action: audit.ActionTokenRevoke, TargetType: audit.TargetPersonalAccessToken, TargetID: uint(id)})
+
+		c.JSON(http.StatusOK, models.SuccessResponse{Message: "Token revoked successfully"})
+	}
+}
@@ -2,11 +2,16 @@
 package controllers
 
 import (
+	"log"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mfuadfakhruzzaki/project/backend/audit"
+	"github.com/mfuadfakhruzzaki/project/backend/mailer"
 	"github.com/mfuadfakhruzzaki/project/backend/models"
+	"github.com/mfuadfakhruzzaki/project/backend/passwords"
+	"github.com/mfuadfakhruzzaki/project/backend/utils"
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
@@ -32,7 +37,7 @@ func GetProfile(db *gorm.DB) gin.HandlerFunc {
 		user := currentUserInterface.(models.User)
 
 		var fullUser models.User
-		if err := db.Preload("Role").First(&fullUser, user.ID).Error; err != nil {
+		if err := db.Preload("Role.Permissions").First(&fullUser, user.ID).Error; err != nil {
 			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "User not found"})
 			return
 		}
@@ -43,7 +48,7 @@ func GetProfile(db *gorm.DB) gin.HandlerFunc {
 
 // UpdateProfile godoc
 // @Summary Memperbarui profil pengguna
-// @Description Memperbarui informasi profil pengguna yang sedang login
+// @Description Memperbarui informasi profil pengguna yang sedang login. Mengganti password atau email memerlukan current_password. Mengganti password akan mencabut semua sesi serta personal access token, mengganti email memerlukan verifikasi ulang
 // @Tags Profile
 // @Security BearerAuth
 // @Param profile body models.UpdateProfileInput true "Update Profile"
@@ -51,9 +56,11 @@ func GetProfile(db *gorm.DB) gin.HandlerFunc {
 // @Success 200 {object} models.SuccessResponse
 // @Failure 400 {object} models.ErrorResponse
 // @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /profile [put]
-func UpdateProfile(db *gorm.DB) gin.HandlerFunc {
+func UpdateProfile(db *gorm.DB, m mailer.Mailer) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var input models.UpdateProfileInput
 		if err := c.ShouldBindJSON(&input); err != nil {
@@ -68,12 +75,31 @@ func UpdateProfile(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		user := currentUserInterface.(models.User)
+		before := user
+
+		// Changing the password or email hands over the account, so a stolen session alone isn't enough.
+		// Wrong guesses count towards the same lockout as failed logins.
+		if input.Password != "" || (input.Email != "" && input.Email != user.Email) {
+			if input.CurrentPassword == "" {
+				c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Current password is required to change password or email"})
+				return
+			}
+			if !checkLoginThrottle(db, c, user.Email) {
+				return
+			}
+			if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.CurrentPassword)); err != nil {
+				recordLoginFailure(db, c, user.ID, user.Email, "invalid_current_password")
+				c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "Current password is incorrect"})
+				return
+			}
+		}
 
 		// Update fields if provided
 		if input.Username != "" {
 			user.Username = input.Username
 		}
-		if input.Email != "" {
+		emailChanged := false
+		if input.Email != "" && input.Email != user.Email {
 			// Check if email is taken
 			var existingUser models.User
 			if err := db.Where("email = ? AND id != ?", input.Email, user.ID).First(&existingUser).Error; err == nil {
@@ -81,8 +107,16 @@ func UpdateProfile(db *gorm.DB) gin.HandlerFunc {
 				return
 			}
 			user.Email = input.Email
+			// The new address has to be verified again
+			user.EmailVerifiedAt = nil
+			emailChanged = true
 		}
 		if input.Password != "" {
+			if err := passwords.Validate(input.Password, user.Username, user.Email); err != nil {
+				c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+				return
+			}
+
 			hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to hash password"})
@@ -98,6 +132,78 @@ func UpdateProfile(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		if emailChanged {
+			if err := sendVerificationEmail(db, m, user); err != nil {
+				log.Printf("failed to send verification email: %v", err)
+			}
+		}
+
+		// A password change signs the user out everywhere
+		if input.Password != "" {
+			if err := revokeAllSessions(db, user.ID); err != nil {
+				c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to revoke sessions"})
+				return
+			}
+		}
+
+		audit.Record(db, c, audit.Entry{Action: audit.ActionProfileUpdate, TargetType: audit.TargetUser, TargetID: user.ID, Before: before, After: user})
+		if input.Password != "" {
+			audit.Record(db, c, audit.Entry{Action: audit.ActionPasswordChange, TargetType: audit.TargetUser, TargetID: user.ID})
+		}
+
 		c.JSON(http.StatusOK, models.SuccessResponse{Message: "Profile updated successfully"})
 	}
 }
+
+// GetSecurityEvents godoc
+// @Summary Mengambil riwayat keamanan
+// @Description Mengambil riwayat keamanan akun pengguna yang sedang login, seperti login, login gagal, penguncian akun, dan perubahan password, terbaru lebih dulu
+// @Tags Profile
+// @Security BearerAuth
+// @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Page size (max 100)" default(20)
+// @Success 200 {object} models.SecurityEventListResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /profile/security-events [get]
+func GetSecurityEvents(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		currentUserInterface, exists := c.Get("currentUser")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not found"})
+			return
+		}
+
+		user := currentUserInterface.(models.User)
+
+		page, pageSize := utils.GetPagination(c)
+
+		filtered := db.Model(&models.AuditLog{}).Where("target_type = ? AND target_id = ?", audit.TargetUser, user.ID)
+
+		var total int64
+		if err := filtered.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to count security events"})
+			return
+		}
+
+		events := []models.AuditLog{}
+		if err := filtered.Order("created_at DESC").Order("id DESC").
+			Offset((page - 1) * pageSize).
+			Limit(pageSize).
+			Find(&events).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to fetch security events"})
+			return
+		}
+
+		c.JSON(http.StatusOK, models.SecurityEventListResponse{
+			Data: events,
+			Meta: models.PaginationMeta{
+				Page:       page,
+				PageSize:   pageSize,
+				Total:      total,
+				TotalPages: utils.TotalPages(total, pageSize),
+			},
+		})
+	}
+}
@@ -0,0 +1,497 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mfuadfakhruzzaki/project/backend/audit"
+	"github.com/mfuadfakhruzzaki/project/backend/models"
+	"github.com/mfuadfakhruzzaki/project/backend/policies"
+	"github.com/mfuadfakhruzzaki/project/backend/utils"
+	"gorm.io/gorm"
+)
+
+var (
+	errProjectNotFound = errors.New("project not found")
+	errProjectArchived = errors.New("project is archived")
+)
+
+// loadProjectForTask returns the project a task is being placed in,
+// making sure it is visible to the user and still active
+func loadProjectForTask(db *gorm.DB, user models.User, projectID uint) (models.Project, error) {
+	var project models.Project
+	if err := db.First(&project, projectID).Error; err != nil {
+		return project, errProjectNotFound
+	}
+
+	if err := policies.AuthorizeProject(db, user, project, policies.ProjectRead); err != nil {
+		if errors.Is(err, policies.ErrProjectHidden) {
+			return project, errProjectNotFound
+		}
+		return project, err
+	}
+
+	if project.IsArchived {
+		return project, errProjectArchived
+	}
+
+	return project, nil
+}
+
+// authorizeTaskMove makes sure the user may manage a project a task is moved out of or into.
+// Moving a task changes who can see it, so being able to read the project is not enough.
+func authorizeTaskMove(db *gorm.DB, user models.User, projectID uint) error {
+	var project models.Project
+	if err := db.First(&project, projectID).Error; err != nil {
+		return errProjectNotFound
+	}
+
+	err := policies.AuthorizeProject(db, user, project, policies.ProjectManage)
+	if errors.Is(err, policies.ErrProjectHidden) {
+		return errProjectNotFound
+	}
+	return err
+}
+
+// projectErrorResponse maps errors from loadProjectForTask and authorizeTaskMove to an HTTP response
+func projectErrorResponse(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errProjectNotFound):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Project not found"})
+	case errors.Is(err, errProjectArchived):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Project is archived"})
+	case errors.Is(err, policies.ErrProjectForbidden):
+		c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "Only the project owner can move tasks between projects"})
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to check project permissions"})
+	}
+}
+
+// checkProjectAssignees makes sure every assignee belongs to the project
+func checkProjectAssignees(db *gorm.DB, project models.Project, userIDs []uint) (bool, error) {
+	for _, userID := range userIDs {
+		member, err := policies.IsProjectMember(db, userID, project)
+		if err != nil || !member {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// GetProjects godoc
+// @Summary Mengambil daftar proyek
+// @Description Mengambil daftar proyek yang dimiliki atau diikuti oleh pengguna
+// @Tags Projects
+// @Security BearerAuth
+// @Produce json
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Page size" default(20)
+// @Param archived query bool false "Include archived projects"
+// @Success 200 {object} models.ProjectListResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/projects [get]
+func GetProjects(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		currentUserInterface, exists := c.Get("currentUser")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not found"})
+			return
+		}
+
+		user := currentUserInterface.(models.User)
+
+		page, pageSize := utils.GetPagination(c)
+
+		query := db.Model(&models.Project{}).Scopes(policies.VisibleProjects(user))
+		if c.Query("archived") != "true" {
+			query = query.Where("is_archived = ?", false)
+		}
+
+		var total int64
+		if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to count projects"})
+			return
+		}
+
+		projects := []models.Project{}
+		if err := query.Preload("Owner").Preload("Members.User").
+			Order("created_at DESC").
+			Offset((page - 1) * pageSize).
+			Limit(pageSize).
+			Find(&projects).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to fetch projects"})
+			return
+		}
+
+		c.JSON(http.StatusOK, models.ProjectListResponse{
+			Data: projects,
+			Meta: models.PaginationMeta{
+				Page:       page,
+				PageSize:   pageSize,
+				Total:      total,
+				TotalPages: utils.TotalPages(total, pageSize),
+			},
+		})
+	}
+}
+
+// CreateProject godoc
+// @Summary Membuat proyek baru
+// @Description Membuat proyek baru dengan pengguna saat ini sebagai pemilik
+// @Tags Projects
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param project body models.CreateProjectInput true "Create Project"
+// @Success 201 {object} models.Project
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/projects [post]
+func CreateProject(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input models.CreateProjectInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		currentUserInterface, exists := c.Get("currentUser")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not found"})
+			return
+		}
+
+		user := currentUserInterface.(models.User)
+
+		// Check that all members exist
+		for _, memberID := range input.MemberIDs {
+			var member models.User
+			if err := db.First(&member, memberID).Error; err != nil {
+				c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Member user not found"})
+				return
+			}
+		}
+
+		project := models.Project{
+			Name:        input.Name,
+			Description: input.Description,
+			OwnerID:     user.ID,
+			CreatedAt:   time.Now(),
+			UpdatedAt:   time.Now(),
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&project).Error; err != nil {
+				return err
+			}
+
+			added := map[uint]bool{user.ID: true}
+			for _, memberID := range input.MemberIDs {
+				// The owner is implicitly a member
+				if added[memberID] {
+					continue
+				}
+				added[memberID] = true
+
+				member := models.ProjectMember{
+					ProjectID: project.ID,
+					UserID:    memberID,
+					CreatedAt: time.Now(),
+				}
+				if err := tx.Create(&member).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to create project"})
+			return
+		}
+
+		if err := db.Preload("Owner").Preload("Members.User").First(&project, project.ID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to fetch created project"})
+			return
+		}
+
+		audit.Record(db, c, audit.Entry{Action: audit.ActionProjectCreate, TargetType: audit.TargetProject, TargetID: project.ID, After: project})
+
+		c.JSON(http.StatusCreated, project)
+	}
+}
+
+// GetProjectByID godoc
+// @Summary Mengambil detail proyek
+// @Description Mengambil detail proyek berdasarkan ID
+// @Tags Projects
+// @Security BearerAuth
+// @Param id path int true "Project ID"
+// @Produce json
+// @Success 200 {object} models.Project
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Router /api/projects/{id} [get]
+func GetProjectByID(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid project ID"})
+			return
+		}
+
+		var project models.Project
+		if err := db.Preload("Owner").Preload("Members.User").First(&project, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Project not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, project)
+	}
+}
+
+// UpdateProject godoc
+// @Summary Memperbarui proyek
+// @Description Memperbarui nama, deskripsi atau status arsip proyek. Hanya pemilik atau admin
+// @Tags Projects
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param project body models.UpdateProjectInput true "Update Project"
+// @Success 200 {object} models.Project
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/projects/{id} [put]
+func UpdateProject(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid project ID"})
+			return
+		}
+
+		var input models.UpdateProjectInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		var project models.Project
+		if err := db.First(&project, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Project not found"})
+			return
+		}
+
+		before := project
+
+		// Update fields if provided
+		if input.Name != "" {
+			project.Name = input.Name
+		}
+		if input.Description != "" {
+			project.Description = input.Description
+		}
+		if input.IsArchived != nil && *input.IsArchived != project.IsArchived {
+			project.IsArchived = *input.IsArchived
+			if project.IsArchived {
+				now := time.Now()
+				project.ArchivedAt = &now
+			} else {
+				project.ArchivedAt = nil
+			}
+		}
+
+		project.UpdatedAt = time.Now()
+
+		if err := db.Save(&project).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to update project"})
+			return
+		}
+
+		if err := db.Preload("Owner").Preload("Members.User").First(&project, project.ID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to fetch updated project"})
+			return
+		}
+
+		audit.Record(db, c, audit.Entry{Action: audit.ActionProjectUpdate, TargetType: audit.TargetProject, TargetID: project.ID, Before: before, After: project})
+
+		c.JSON(http.StatusOK, project)
+	}
+}
+
+// DeleteProject godoc
+// @Summary Menghapus proyek
+// @Description Menghapus proyek berdasarkan ID. Tugas di dalamnya dilepas dari proyek. Hanya pemilik atau admin
+// @Tags Projects
+// @Security BearerAuth
+// @Param id path int true "Project ID"
+// @Produce json
+// @Success 200 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/projects/{id} [delete]
+func DeleteProject(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid project ID"})
+			return
+		}
+
+		var project models.Project
+		if err := db.First(&project, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Project not found"})
+			return
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.Task{}).Where("project_id = ?", project.ID).Update("project_id", nil).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("project_id = ?", project.ID).Delete(&models.ProjectMember{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&project).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to delete project"})
+			return
+		}
+
+		audit.Record(db, c, audit.Entry{Action: audit.ActionProjectDelete, TargetType: audit.TargetProject, TargetID: project.ID, Before: project})
+
+		c.JSON(http.StatusOK, models.SuccessResponse{Message: "Project deleted successfully"})
+	}
+}
+
+// AddProjectMember godoc
+// @Summary Menambahkan anggota proyek
+// @Description Menambahkan pengguna sebagai anggota proyek. Hanya pemilik atau admin
+// @Tags Projects
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Project ID"
+// @Param member body models.AddProjectMemberInput true "Member"
+// @Success 201 {object} models.ProjectMember
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/projects/{id}/members [post]
+func AddProjectMember(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid project ID"})
+			return
+		}
+
+		var input models.AddProjectMemberInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		var project models.Project
+		if err := db.First(&project, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Project not found"})
+			return
+		}
+
+		var user models.User
+		if err := db.First(&user, input.UserID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "User not found"})
+			return
+		}
+
+		isMember, err := policies.IsProjectMember(db, user.ID, project)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to check project membership"})
+			return
+		}
+		if isMember {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "User is already a member of the project"})
+			return
+		}
+
+		member := models.ProjectMember{
+			ProjectID: project.ID,
+			UserID:    user.ID,
+			CreatedAt: time.Now(),
+		}
+		if err := db.Create(&member).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to add project member"})
+			return
+		}
+
+		audit.Record(db, c, audit.Entry{
+			Action:     audit.ActionProjectMemberAdd,
+			TargetType: audit.TargetProject,
+			TargetID:   project.ID,
+			After:      map[string]interface{}{"user_id": user.ID},
+		})
+
+		member.User = user
+		c.JSON(http.StatusCreated, member)
+	}
+}
+
+// RemoveProjectMember godoc
+// @Summary Menghapus anggota proyek
+// @Description Menghapus pengguna dari keanggotaan proyek. Hanya pemilik atau admin
+// @Tags Projects
+// @Security BearerAuth
+// @Param id path int true "Project ID"
+// @Param userId path int true "User ID"
+// @Produce json
+// @Success 200 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/projects/{id}/members/{userId} [delete]
+func RemoveProjectMember(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid project ID"})
+			return
+		}
+
+		userID, err := strconv.Atoi(c.Param("userId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid user ID"})
+			return
+		}
+
+		var member models.ProjectMember
+		if err := db.Where("project_id = ? AND user_id = ?", id, userID).First(&member).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Project member not found"})
+			return
+		}
+
+		if err := db.Delete(&member).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to remove project member"})
+			return
+		}
+
+		audit.Record(db, c, audit.Entry{
+			Action:     audit.ActionProjectMemberRemove,
+			TargetType: audit.TargetProject,
+			TargetID:   member.ProjectID,
+			Before:     map[string]interface{}{"user_id": member.UserID},
+		})
+
+		c.JSON(http.StatusOK, models.SuccessResponse{Message: "Project member removed successfully"})
+	}
+}
@@ -0,0 +1,386 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mfuadfakhruzzaki/project/backend/audit"
+	"github.com/mfuadfakhruzzaki/project/backend/models"
+	"github.com/mfuadfakhruzzaki/project/backend/policies"
+	"gorm.io/gorm"
+)
+
+var errUnknownPermission = errors.New("unknown permission")
+
+// loadPermissions looks up permissions by name, failing with errUnknownPermission if any is missing
+func loadPermissions(db *gorm.DB, names []string) ([]models.Permission, error) {
+	permissions := []models.Permission{}
+	if len(names) == 0 {
+		return permissions, nil
+	}
+
+	if err := db.Where("name IN ?", names).Find(&permissions).Error; err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool, len(permissions))
+	for _, p := range permissions {
+		found[p.Name] = true
+	}
+	for _, name := range names {
+		if !found[name] {
+			return nil, errUnknownPermission
+		}
+	}
+
+	return permissions, nil
+}
+
+// ungrantedPermission returns the name of the first permission the caller would grant without holding
+// it, or "" if there is none. Permissions the role already has are not being granted. Without this
+// check roles.manage would be enough to give oneself any permission.
+func ungrantedPermission(caller models.User, permissions []models.Permission, existing []models.Permission) string {
+	had := make(map[string]bool, len(existing))
+	for _, p := range existing {
+		had[p.Name] = true
+	}
+
+	for _, p := range permissions {
+		if !had[p.Name] && !policies.HasPermission(caller, policies.Permission(p.Name)) {
+			return p.Name
+		}
+	}
+	return ""
+}
+
+// hasPermissionNamed reports whether the list contains the permission
+func hasPermissionNamed(permissions []models.Permission, permission policies.Permission) bool {
+	for _, p := range permissions {
+		if p.Name == string(permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// isBuiltInRole reports whether the role is created by the seeder and relied upon by the application
+func isBuiltInRole(role models.Role) bool {
+	return role.Name == policies.DefaultRoleName || role.Name == policies.AdminRoleName
+}
+
+// roleAuditState flattens a role for the audit log, listing its permissions by name
+func roleAuditState(role models.Role) map[string]interface{} {
+	permissions := make([]string, 0, len(role.Permissions))
+	for _, p := range role.Permissions {
+		permissions = append(permissions, p.Name)
+	}
+
+	return map[string]interface{}{
+		"name":        role.Name,
+		"description": role.Description,
+		"permissions": permissions,
+	}
+}
+
+// GetPermissions godoc
+// @Summary Mengambil daftar permission
+// @Description Mengambil semua permission yang dapat diberikan ke role
+// @Tags Admin - Role Management
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} models.Permission
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/admin/permissions [get]
+func GetPermissions(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var permissions []models.Permission
+		if err := db.Order("name").Find(&permissions).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to retrieve permissions"})
+			return
+		}
+
+		c.JSON(http.StatusOK, permissions)
+	}
+}
+
+// GetRoles godoc
+// @Summary Mengambil daftar role
+// @Description Mengambil semua role beserta permission-nya
+// @Tags Admin - Role Management
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} models.Role
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/admin/roles [get]
+func GetRoles(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var roles []models.Role
+		if err := db.Preload("Permissions").Order("id").Find(&roles).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to retrieve roles"})
+			return
+		}
+
+		c.JSON(http.StatusOK, roles)
+	}
+}
+
+// CreateRole godoc
+// @Summary Membuat role baru
+// @Description Membuat role baru dengan daftar permission. Hanya permission yang dimiliki pemanggil yang dapat diberikan
+// @Tags Admin - Role Management
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param role body models.CreateRoleInput true "Create Role"
+// @Success 201 {object} models.Role
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/admin/roles [post]
+func CreateRole(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		currentUserInterface, exists := c.Get("currentUser")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not found"})
+			return
+		}
+		currentUser := currentUserInterface.(models.User)
+
+		var input models.CreateRoleInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		var count int64
+		if err := db.Model(&models.Role{}).Where("name = ?", input.Name).Count(&count).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to create role"})
+			return
+		}
+		if count > 0 {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Role name already exists"})
+			return
+		}
+
+		permissions, err := loadPermissions(db, input.Permissions)
+		if errors.Is(err, errUnknownPermission) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Unknown permission"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to create role"})
+			return
+		}
+		if name := ungrantedPermission(currentUser, permissions, nil); name != "" {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "You cannot grant a permission you do not have: " + name})
+			return
+		}
+
+		role := models.Role{
+			Name:        input.Name,
+			Description: input.Description,
+			Permissions: permissions,
+		}
+		if err := db.Create(&role).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to create role"})
+			return
+		}
+
+		audit.Record(db, c, audit.Entry{Action: audit.ActionRoleCreate, TargetType: audit.TargetRole, TargetID: role.ID, After: roleAuditState(role)})
+
+		c.JSON(http.StatusCreated, role)
+	}
+}
+
+// UpdateRole godoc
+// @Summary Memperbarui role
+// @Description Memperbarui nama, deskripsi, atau permission role. Role bawaan tidak dapat diganti namanya dan permission role admin tidak dapat diubah
+// @Description Hanya permission yang dimiliki pemanggil yang dapat ditambahkan, dan users.manage tidak dapat dicabut jika tidak ada pengguna aktif lain di luar role yang memilikinya
+// @Tags Admin - Role Management
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Role ID"
+// @Param role body models.UpdateRoleInput true "Update Role"
+// @Success 200 {object} models.Role
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/admin/roles/{id} [put]
+func UpdateRole(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idParam := c.Param("id")
+		id, err := strconv.Atoi(idParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid role ID"})
+			return
+		}
+
+		currentUserInterface, exists := c.Get("currentUser")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not found"})
+			return
+		}
+		currentUser := currentUserInterface.(models.User)
+
+		var input models.UpdateRoleInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		var role models.Role
+		if err := db.Preload("Permissions").First(&role, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Role not found"})
+			return
+		}
+		before := roleAuditState(role)
+
+		if input.Name != "" && input.Name != role.Name {
+			if isBuiltInRole(role) {
+				c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "Built-in roles cannot be renamed"})
+				return
+			}
+
+			var count int64
+			if err := db.Model(&models.Role{}).Where("name = ?", input.Name).Count(&count).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to update role"})
+				return
+			}
+			if count > 0 {
+				c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Role name already exists"})
+				return
+			}
+			role.Name = input.Name
+		}
+
+		if input.Description != nil {
+			role.Description = *input.Description
+		}
+
+		// The admin role keeps every permission so there is always a way back in
+		var permissions []models.Permission
+		if input.Permissions != nil {
+			if role.Name == policies.AdminRoleName {
+				c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "Permissions of the admin role cannot be changed"})
+				return
+			}
+
+			permissions, err = loadPermissions(db, input.Permissions)
+			if errors.Is(err, errUnknownPermission) {
+				c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Unknown permission"})
+				return
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to update role"})
+				return
+			}
+			if name := ungrantedPermission(currentUser, permissions, role.Permissions); name != "" {
+				c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "You cannot grant a permission you do not have: " + name})
+				return
+			}
+		}
+
+		// Taking users.manage from the role must leave someone else able to manage users
+		dropsUsersManage := input.Permissions != nil &&
+			hasPermissionNamed(role.Permissions, policies.PermUsersManage) &&
+			!hasPermissionNamed(permissions, policies.PermUsersManage)
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if dropsUsersManage {
+				if err := ensureAdminOutsideRole(tx, role.ID); err != nil {
+					return err
+				}
+			}
+			if err := tx.Omit("Permissions").Save(&role).Error; err != nil {
+				return err
+			}
+			if input.Permissions != nil {
+				return tx.Model(&role).Association("Permissions").Replace(permissions)
+			}
+			return nil
+		})
+		if errors.Is(err, errLastAdmin) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Cannot remove users.manage from the role of the last admin"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to update role"})
+			return
+		}
+
+		if err := db.Preload("Permissions").First(&role, role.ID).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to retrieve role"})
+			return
+		}
+
+		audit.Record(db, c, audit.Entry{Action: audit.ActionRoleUpdate, TargetType: audit.TargetRole, TargetID: role.ID, Before: before, After: roleAuditState(role)})
+
+		c.JSON(http.StatusOK, role)
+	}
+}
+
+// DeleteRole godoc
+// @Summary Menghapus role
+// @Description Menghapus role yang tidak lagi digunakan. Role bawaan dan role yang masih dimiliki pengguna tidak dapat dihapus
+// @Tags Admin - Role Management
+// @Security BearerAuth
+// @Param id path int true "Role ID"
+// @Produce json
+// @Success 200 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/admin/roles/{id} [delete]
+func DeleteRole(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idParam := c.Param("id")
+		id, err := strconv.Atoi(idParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid role ID"})
+			return
+		}
+
+		var role models.Role
+		if err := db.First(&role, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Role not found"})
+			return
+		}
+
+		if isBuiltInRole(role) {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "Built-in roles cannot be deleted"})
+			return
+		}
+
+		var users int64
+		if err := db.Model(&models.User{}).Where("role_id = ?", role.ID).Count(&users).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to delete role"})
+			return
+		}
+		if users > 0 {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Role is still assigned to users"})
+			return
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&role).Association("Permissions").Clear(); err != nil {
+				return err
+			}
+			return tx.Delete(&role).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to delete role"})
+			return
+		}
+
+		audit.Record(db, c, audit.Entry{Action: audit.ActionRoleDelete, TargetType: audit.TargetRole, TargetID: role.ID, Before: roleAuditState(role)})
+
+		c.JSON(http.StatusOK, models.SuccessResponse{Message: "Role deleted successfully"})
+	}
+}
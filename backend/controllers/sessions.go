@@ -0,0 +1,111 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mfuadfakhruzzaki/project/backend/audit"
+	"github.com/mfuadfakhruzzaki/project/backend/models"
+	"gorm.io/gorm"
+)
+
+// GetSessions godoc
+// @Summary Mengambil daftar sesi aktif
+// @Description Mengambil perangkat tempat pengguna yang sedang login masih masuk, beserta IP dan waktu terakhir aktif
+// @Tags Sessions
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} models.SessionResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /profile/sessions [get]
+func GetSessions(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		currentUserInterface, exists := c.Get("currentUser")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not found"})
+			return
+		}
+
+		user := currentUserInterface.(models.User)
+		currentSessionID := c.GetUint("sessionID")
+
+		var sessions []models.Session
+		if err := db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", user.ID, time.Now()).
+			Order("last_seen_at DESC").Find(&sessions).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to retrieve sessions"})
+			return
+		}
+
+		response := make([]models.SessionResponse, 0, len(sessions))
+		for _, session := range sessions {
+			response = append(response, models.SessionResponse{
+				ID:         session.ID,
+				Device:     session.Device,
+				IP:         session.IP,
+				UserAgent:  session.UserAgent,
+				LastSeenAt: session.LastSeenAt,
+				CreatedAt:  session.CreatedAt,
+				Current:    session.ID == currentSessionID,
+			})
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// RevokeSession godoc
+// @Summary Mengakhiri sesi
+// @Description Mengeluarkan pengguna dari sesi di perangkat lain. Token akses dan refresh token sesi tersebut langsung tidak berlaku
+// @Tags Sessions
+// @Security BearerAuth
+// @Param id path int true "Session ID"
+// @Produce json
+// @Success 200 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /profile/sessions/{id} [delete]
+func RevokeSession(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idParam := c.Param("id")
+		id, err := strconv.Atoi(idParam)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid session ID"})
+			return
+		}
+
+		currentUserInterface, exists := c.Get("currentUser")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not found"})
+			return
+		}
+
+		user := currentUserInterface.(models.User)
+
+		var session models.Session
+		if err := db.Where("id = ? AND user_id = ? AND revoked_at IS NULL", id, user.ID).First(&session).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Session not found"})
+			return
+		}
+
+		if err := revokeTokenFamily(db, session.FamilyID); err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to revoke session"})
+			return
+		}
+
+		audit.Record(db, c, audit.Entry{
+			Action:     audit.ActionSessionRevoke,
+			TargetType: audit.TargetSession,
+			TargetID:   session.ID,
+			Before:     map[string]interface{}{"device": session.Device, "ip": session.IP},
+		})
+
+		c.JSON(http.StatusOK, models.SuccessResponse{Message: "Session revoked successfully"})
+	}
+}
@@ -0,0 +1,94 @@
+package controllers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mfuadfakhruzzaki/project/backend/models"
+	"gorm.io/gorm"
+)
+
+// storageReportTop is how many projects and uploaders the storage report lists
+const storageReportTop = 20
+
+// GetStorageReport godoc
+// @Summary Mengambil laporan penggunaan storage
+// @Description Mengambil total ukuran aset, ukuran yang benar-benar tersimpan setelah deduplikasi, serta 20 proyek dan pengunggah dengan penggunaan terbesar
+// @Tags Admin - Storage
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} models.StorageReport
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/admin/storage [get]
+func GetStorageReport(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var assets struct {
+			AssetCount int64
+			Bytes      int64
+		}
+		if err := db.Model(&models.Asset{}).
+			Select("COUNT(*) AS asset_count, COALESCE(SUM(size), 0) AS bytes").
+			Scan(&assets).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to calculate storage usage"})
+			return
+		}
+
+		var blobs struct {
+			BlobCount int64
+			Bytes     int64
+		}
+		if err := db.Model(&models.Blob{}).
+			Select("COUNT(*) AS blob_count, COALESCE(SUM(size), 0) AS bytes").
+			Scan(&blobs).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to calculate storage usage"})
+			return
+		}
+
+		// Assets from before deduplication own their file
+		var unshared int64
+		if err := db.Model(&models.Asset{}).
+			Where("blob_id IS NULL").
+			Select("COALESCE(SUM(size), 0)").
+			Scan(&unshared).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to calculate storage usage"})
+			return
+		}
+
+		report := models.StorageReport{
+			AssetCount:   assets.AssetCount,
+			BlobCount:    blobs.BlobCount,
+			LogicalBytes: assets.Bytes,
+			StoredBytes:  blobs.Bytes + unshared,
+		}
+		report.SavedBytes = report.LogicalBytes - report.StoredBytes
+
+		report.ByProject = []models.StorageUsage{}
+		if err := db.Table("assets").
+			Select("COALESCE(projects.id, 0) AS id, COALESCE(projects.name, '') AS name, COUNT(assets.id) AS asset_count, COALESCE(SUM(assets.size), 0) AS bytes").
+			// Assets left behind by tasks deleted before their assets were cleaned up count as "no project"
+			Joins("LEFT JOIN tasks ON tasks.id = assets.task_id").
+			Joins("LEFT JOIN projects ON projects.id = tasks.project_id").
+			Group("projects.id, projects.name").
+			Order("bytes DESC").
+			Limit(storageReportTop).
+			Scan(&report.ByProject).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to calculate storage usage"})
+			return
+		}
+
+		report.ByUploader = []models.StorageUsage{}
+		if err := db.Table("assets").
+			Select("users.id AS id, users.username AS name, COUNT(assets.id) AS asset_count, COALESCE(SUM(assets.size), 0) AS bytes").
+			Joins("JOIN users ON users.id = assets.uploaded_by").
+			Group("users.id, users.username").
+			Order("bytes DESC").
+			Limit(storageReportTop).
+			Scan(&report.ByUploader).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to calculate storage usage"})
+			return
+		}
+
+		c.JSON(http.StatusOK, report)
+	}
+}
@@ -0,0 +1,408 @@
+package controllers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mfuadfakhruzzaki/project/backend/audit"
+	"github.com/mfuadfakhruzzaki/project/backend/models"
+	"gorm.io/gorm"
+)
+
+// deriveTaskStatus computes the parent status from its sub-tasks:
+// all completed -> completed, all todo -> todo, anything else -> in_progress
+func deriveTaskStatus(subTasks []models.SubTask) string {
+	completed, todo := 0, 0
+	for _, subTask := range subTasks {
+		switch subTask.Status {
+		case "completed":
+			completed++
+		case "todo":
+			todo++
+		}
+	}
+
+	switch {
+	case completed == len(subTasks):
+		return "completed"
+	case todo == len(subTasks):
+		return "todo"
+	default:
+		return "in_progress"
+	}
+}
+
+// derivedTaskStatus returns the status the task's sub-tasks add up to. ok is false when the task
+// has no sub-tasks and its status can only be set manually.
+func derivedTaskStatus(db *gorm.DB, taskID uint) (status string, ok bool, err error) {
+	var subTasks []models.SubTask
+	if err := db.Where("task_id = ?", taskID).Find(&subTasks).Error; err != nil {
+		return "", false, err
+	}
+	if len(subTasks) == 0 {
+		return "", false, nil
+	}
+	return deriveTaskStatus(subTasks), true, nil
+}
+
+// syncTaskStatus updates the parent task status from its sub-tasks unless the task opted out
+func syncTaskStatus(db *gorm.DB, taskID uint) error {
+	var task models.Task
+	if err := db.First(&task, taskID).Error; err != nil {
+		return err
+	}
+
+	if task.DisableStatusRollup {
+		return nil
+	}
+
+	// Nothing to derive from, keep the manually set status
+	status, ok, err := derivedTaskStatus(db, taskID)
+	if err != nil || !ok || status == task.Status {
+		return err
+	}
+
+	return db.Model(&task).Updates(map[string]interface{}{
+		"status":     status,
+		"updated_at": time.Now(),
+	}).Error
+}
+
+// GetSubTasks godoc
+// @Summary Mengambil daftar sub-tugas
+// @Description Mengambil daftar sub-tugas dari tugas berdasarkan ID tugas, diurutkan berdasarkan posisi
+// @Tags SubTasks
+// @Security BearerAuth
+// @Param id path int true "Task ID"
+// @Produce json
+// @Success 200 {array} models.SubTask
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/tasks/{id}/subtasks [get]
+func GetSubTasks(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		taskID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid task ID"})
+			return
+		}
+
+		var task models.Task
+		if err := db.First(&task, taskID).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Task not found"})
+			return
+		}
+
+		subTasks := []models.SubTask{}
+		if err := db.Where("task_id = ?", task.ID).Order("position ASC, id ASC").Find(&subTasks).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to fetch sub-tasks"})
+			return
+		}
+
+		c.JSON(http.StatusOK, subTasks)
+	}
+}
+
+// CreateSubTask godoc
+// @Summary Membuat sub-tugas baru
+// @Description Membuat sub-tugas baru pada tugas dan memperbarui status tugas induk
+// @Tags SubTasks
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Task ID"
+// @Param subtask body models.CreateSubTaskInput true "Create Sub-Task"
+// @Success 201 {object} models.SubTask
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/tasks/{id}/subtasks [post]
+func CreateSubTask(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		taskID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid task ID"})
+			return
+		}
+
+		var input models.CreateSubTaskInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		var task models.Task
+		if err := db.First(&task, taskID).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Task not found"})
+			return
+		}
+
+		dueDate, err := time.Parse("2006-01-02", input.DueDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid due date format"})
+			return
+		}
+
+		// Append the new sub-task at the end of the list
+		var maxPosition int
+		if err := db.Model(&models.SubTask{}).
+			Where("task_id = ?", task.ID).
+			Select("COALESCE(MAX(position), 0)").
+			Scan(&maxPosition).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to create sub-task"})
+			return
+		}
+
+		subTask := models.SubTask{
+			Title:       input.Title,
+			Description: input.Description,
+			Priority:    input.Priority,
+			Status:      input.Status,
+			DueDate:     dueDate,
+			TaskID:      task.ID,
+			Position:    maxPosition + 1,
+			CreatedAt:   time.Now(),
+			UpdatedAt:   time.Now(),
+		}
+
+		if err := db.Create(&subTask).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to create sub-task"})
+			return
+		}
+
+		if err := syncTaskStatus(db, task.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to update task status"})
+			return
+		}
+
+		audit.Record(db, c, audit.Entry{Action: audit.ActionSubTaskCreate, TargetType: audit.TargetSubTask, TargetID: subTask.ID, After: subTask})
+
+		c.JSON(http.StatusCreated, subTask)
+	}
+}
+
+// UpdateSubTask godoc
+// @Summary Memperbarui sub-tugas
+// @Description Memperbarui sub-tugas berdasarkan ID dan memperbarui status tugas induk
+// @Tags SubTasks
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Task ID"
+// @Param subtaskId path int true "Sub-Task ID"
+// @Param subtask body models.UpdateSubTaskInput true "Update Sub-Task"
+// @Success 200 {object} models.SubTask
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/tasks/{id}/subtasks/{subtaskId} [put]
+func UpdateSubTask(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		taskID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid task ID"})
+			return
+		}
+
+		subTaskID, err := strconv.Atoi(c.Param("subtaskId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid sub-task ID"})
+			return
+		}
+
+		var input models.UpdateSubTaskInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		var subTask models.SubTask
+		if err := db.Where("task_id = ?", taskID).First(&subTask, subTaskID).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Sub-task not found"})
+			return
+		}
+		before := subTask
+
+		// Update fields if provided
+		if input.Title != "" {
+			subTask.Title = input.Title
+		}
+		if input.Description != "" {
+			subTask.Description = input.Description
+		}
+		if input.Priority != "" {
+			subTask.Priority = input.Priority
+		}
+		if input.Status != "" {
+			subTask.Status = input.Status
+		}
+		if input.DueDate != "" {
+			dueDate, err := time.Parse("2006-01-02", input.DueDate)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid due date format"})
+				return
+			}
+			subTask.DueDate = dueDate
+		}
+
+		subTask.UpdatedAt = time.Now()
+
+		if err := db.Save(&subTask).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to update sub-task"})
+			return
+		}
+
+		if err := syncTaskStatus(db, subTask.TaskID); err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to update task status"})
+			return
+		}
+
+		audit.Record(db, c, audit.Entry{Action: audit.ActionSubTaskUpdate, TargetType: audit.TargetSubTask, TargetID: subTask.ID, Before: before, After: subTask})
+
+		c.JSON(http.StatusOK, subTask)
+	}
+}
+
+// DeleteSubTask godoc
+// @Summary Menghapus sub-tugas
+// @Description Menghapus sub-tugas berdasarkan ID dan memperbarui status tugas induk
+// @Tags SubTasks
+// @Security BearerAuth
+// @Produce json
+// @Param id path int true "Task ID"
+// @Param subtaskId path int true "Sub-Task ID"
+// @Success 200 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/tasks/{id}/subtasks/{subtaskId} [delete]
+func DeleteSubTask(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		taskID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid task ID"})
+			return
+		}
+
+		subTaskID, err := strconv.Atoi(c.Param("subtaskId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid sub-task ID"})
+			return
+		}
+
+		var subTask models.SubTask
+		if err := db.Where("task_id = ?", taskID).First(&subTask, subTaskID).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Sub-task not found"})
+			return
+		}
+
+		if err := db.Delete(&subTask).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to delete sub-task"})
+			return
+		}
+
+		if err := syncTaskStatus(db, subTask.TaskID); err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to update task status"})
+			return
+		}
+
+		audit.Record(db, c, audit.Entry{Action: audit.ActionSubTaskDelete, TargetType: audit.TargetSubTask, TargetID: subTask.ID, Before: subTask})
+
+		c.JSON(http.StatusOK, models.SuccessResponse{Message: "Sub-task deleted successfully"})
+	}
+}
+
+// ReorderSubTasks godoc
+// @Summary Mengurutkan ulang sub-tugas
+// @Description Mengatur urutan sub-tugas. Daftar ID harus berisi semua sub-tugas dari tugas tersebut
+// @Tags SubTasks
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param id path int true "Task ID"
+// @Param order body models.ReorderSubTasksInput true "Sub-Task Order"
+// @Success 200 {array} models.SubTask
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
+// @Failure 404 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /api/tasks/{id}/subtasks/reorder [put]
+func ReorderSubTasks(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		taskID, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid task ID"})
+			return
+		}
+
+		var input models.ReorderSubTasksInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		var task models.Task
+		if err := db.First(&task, taskID).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Task not found"})
+			return
+		}
+
+		var subTasks []models.SubTask
+		if err := db.Where("task_id = ?", task.ID).Find(&subTasks).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to fetch sub-tasks"})
+			return
+		}
+
+		// The new order must be a permutation of the task's sub-tasks
+		existing := make(map[uint]bool, len(subTasks))
+		for _, subTask := range subTasks {
+			existing[subTask.ID] = true
+		}
+		if len(input.SubTaskIDs) != len(existing) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Order must contain every sub-task of the task exactly once"})
+			return
+		}
+		seen := make(map[uint]bool, len(input.SubTaskIDs))
+		for _, id := range input.SubTaskIDs {
+			if !existing[id] || seen[id] {
+				c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Order must contain every sub-task of the task exactly once"})
+				return
+			}
+			seen[id] = true
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			for i, id := range input.SubTaskIDs {
+				if err := tx.Model(&models.SubTask{}).Where("id = ?", id).Update("position", i+1).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to reorder sub-tasks"})
+			return
+		}
+
+		subTasks = []models.SubTask{}
+		if err := db.Where("task_id = ?", task.ID).Order("position ASC, id ASC").Find(&subTasks).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to fetch sub-tasks"})
+			return
+		}
+
+		audit.Record(db, c, audit.Entry{
+			Action:     audit.ActionSubTaskReorder,
+			TargetType: audit.TargetTask,
+			TargetID:   task.ID,
+			After:      map[string]interface{}{"sub_task_ids": input.SubTaskIDs},
+		})
+
+		c.JSON(http.StatusOK, subTasks)
+	}
+}
@@ -2,22 +2,102 @@
 package controllers
 
 import (
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mfuadfakhruzzaki/project/backend/audit"
 	"github.com/mfuadfakhruzzaki/project/backend/models"
+	"github.com/mfuadfakhruzzaki/project/backend/policies"
+	"github.com/mfuadfakhruzzaki/project/backend/storage"
+	"github.com/mfuadfakhruzzaki/project/backend/utils"
 	"gorm.io/gorm"
 )
 
+// likeEscaper escapes the LIKE wildcards so search text only matches literally
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// taskSortColumns maps the sort query parameter to an ORDER BY expression
+var taskSortColumns = map[string]string{
+	"due_date":   "due_date",
+	"updated_at": "updated_at",
+	"created_at": "created_at",
+	// Rank priorities so that ascending means low -> high
+	"priority": "CASE priority WHEN 'high' THEN 4 WHEN 'medium' THEN 3 WHEN 'normal' THEN 2 WHEN 'low' THEN 1 ELSE 0 END",
+}
+
+var (
+	errAssigneeNotFound   = errors.New("assigned user not found")
+	errAssigneeUnverified = errors.New("assigned user has not verified their email")
+)
+
+// checkAssignees makes sure every assignee exists and has verified their email when that is required.
+// It runs before anything is written so a rejected request leaves the task untouched.
+func checkAssignees(db *gorm.DB, userIDs []uint) error {
+	for _, userID := range userIDs {
+		var assignedUser models.User
+		if err := db.First(&assignedUser, userID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errAssigneeNotFound
+			}
+			return err
+		}
+		if utils.RequireVerifiedEmail() && assignedUser.EmailVerifiedAt == nil {
+			return errAssigneeUnverified
+		}
+	}
+	return nil
+}
+
+// assigneeErrorResponse maps errors from checkAssignees to an HTTP response
+func assigneeErrorResponse(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errAssigneeNotFound):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Assigned user not found"})
+	case errors.Is(err, errAssigneeUnverified):
+		c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Assigned user has not verified their email"})
+	default:
+		c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to check assigned users"})
+	}
+}
+
+// assignUsers creates an assignment for every user
+func assignUsers(tx *gorm.DB, taskID uint, userIDs []uint) error {
+	for _, userID := range userIDs {
+		assignment := models.TaskAssignment{
+			TaskID: taskID,
+			UserID: userID,
+		}
+		if err := tx.Create(&assignment).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // GetTasks godoc
 // @Summary Mengambil daftar tugas
-// @Description Mengambil daftar tugas yang ditugaskan atau dibuat oleh pengguna
+// @Description Mengambil daftar tugas yang ditugaskan, dibuat oleh pengguna atau berada di proyek pengguna dengan paginasi, filter dan pengurutan
 // @Tags Tasks
 // @Security BearerAuth
 // @Produce json
-// @Success 200 {array} models.Task
+// @Param page query int false "Page number" default(1)
+// @Param page_size query int false "Page size" default(20)
+// @Param project_id query int false "Filter by project ID"
+// @Param status query string false "Filter by status" Enums(todo, in_progress, completed)
+// @Param priority query string false "Filter by priority" Enums(high, medium, normal, low)
+// @Param assignee_id query int false "Filter by assigned user ID"
+// @Param creator_id query int false "Filter by creator user ID"
+// @Param due_from query string false "Due date lower bound (YYYY-MM-DD)"
+// @Param due_to query string false "Due date upper bound (YYYY-MM-DD)"
+// @Param q query string false "Search in title and description"
+// @Param sort query string false "Sort key" Enums(due_date, priority, updated_at, created_at) default(created_at)
+// @Param order query string false "Sort direction" Enums(asc, desc) default(desc)
+// @Success 200 {object} models.TaskListResponse
+// @Failure 400 {object} models.ErrorResponse
 // @Failure 401 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /api/tasks [get]
@@ -31,20 +111,88 @@ func GetTasks(db *gorm.DB) gin.HandlerFunc {
 
 		user := currentUserInterface.(models.User)
 
-		var tasks []models.Task
-		// Fetch tasks where user is creator or assigned
-		if err := db.Preload("Creator").Preload("AssignedTo.User").
-			Preload("Comments").
-			Preload("Assets").
-			Preload("SubTasks").
-			Where("created_by = ?", user.ID).
-			Or("id IN (SELECT task_id FROM task_assignments WHERE user_id = ?)", user.ID).
+		var query models.TaskListQuery
+		if err := c.ShouldBindQuery(&query); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		page, pageSize := utils.GetPagination(c)
+
+		filtered := db.Model(&models.Task{}).Scopes(policies.VisibleTasks(user))
+
+		if query.ProjectID != 0 {
+			filtered = filtered.Where("project_id = ?", query.ProjectID)
+		}
+		if query.Status != "" {
+			filtered = filtered.Where("status = ?", query.Status)
+		}
+		if query.Priority != "" {
+			filtered = filtered.Where("priority = ?", query.Priority)
+		}
+		if query.AssigneeID != 0 {
+			filtered = filtered.Where("id IN (SELECT task_id FROM task_assignments WHERE user_id = ?)", query.AssigneeID)
+		}
+		if query.CreatorID != 0 {
+			filtered = filtered.Where("created_by = ?", query.CreatorID)
+		}
+		if query.DueFrom != "" {
+			dueFrom, err := time.Parse("2006-01-02", query.DueFrom)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid due_from format"})
+				return
+			}
+			filtered = filtered.Where("due_date >= ?", dueFrom)
+		}
+		if query.DueTo != "" {
+			dueTo, err := time.Parse("2006-01-02", query.DueTo)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid due_to format"})
+				return
+			}
+			// Include the whole due_to day
+			filtered = filtered.Where("due_date < ?", dueTo.AddDate(0, 0, 1))
+		}
+		if query.Search != "" {
+			pattern := "%" + likeEscaper.Replace(query.Search) + "%"
+			filtered = filtered.Where(`title ILIKE ? ESCAPE '\' OR description ILIKE ? ESCAPE '\'`, pattern, pattern)
+		}
+
+		var total int64
+		if err := filtered.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to count tasks"})
+			return
+		}
+
+		sort := "created_at"
+		if query.Sort != "" {
+			sort = query.Sort
+		}
+		order := "DESC"
+		if query.Order == "asc" {
+			order = "ASC"
+		}
+
+		tasks := []models.Task{}
+		if err := filtered.Preload("Creator").Preload("AssignedTo.User").
+			Order(taskSortColumns[sort] + " " + order).
+			Order("id " + order).
+			Offset((page - 1) * pageSize).
+			Limit(pageSize).
 			Find(&tasks).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to fetch tasks"})
 			return
 		}
 
-		c.JSON(http.StatusOK, tasks)
+		c.JSON(http.StatusOK, models.TaskListResponse{
+			Data: tasks,
+			Meta: models.PaginationMeta{
+				Page:       page,
+				PageSize:   pageSize,
+				Total:      total,
+				TotalPages: utils.TotalPages(total, pageSize),
+			},
+		})
 	}
 }
 
@@ -82,6 +230,29 @@ func CreateTask(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		if err := checkAssignees(db, input.AssignedTo); err != nil {
+			assigneeErrorResponse(c, err)
+			return
+		}
+
+		if input.ProjectID != nil {
+			project, err := loadProjectForTask(db, user, *input.ProjectID)
+			if err != nil {
+				projectErrorResponse(c, err)
+				return
+			}
+
+			ok, err := checkProjectAssignees(db, project, input.AssignedTo)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to check project membership"})
+				return
+			}
+			if !ok {
+				c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Assigned users must be members of the project"})
+				return
+			}
+		}
+
 		task := models.Task{
 			Title:       input.Title,
 			Description: input.Description,
@@ -91,30 +262,21 @@ func CreateTask(db *gorm.DB) gin.HandlerFunc {
 			CreatedBy:   user.ID,
 			CreatedAt:   time.Now(),
 			UpdatedAt:   time.Now(),
-		}
 
-		if err := db.Create(&task).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to create task"})
-			return
+			DisableStatusRollup: input.DisableStatusRollup,
+			ProjectID:           input.ProjectID,
 		}
 
-		// Assign users if any
-		for _, userID := range input.AssignedTo {
-			// Check if user exists
-			var assignedUser models.User
-			if err := db.First(&assignedUser, userID).Error; err != nil {
-				c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Assigned user not found"})
-				return
-			}
-
-			assignment := models.TaskAssignment{
-				TaskID: task.ID,
-				UserID: userID,
-			}
-			if err := db.Create(&assignment).Error; err != nil {
-				c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to assign user to task"})
-				return
+		// Create the task and its assignments together
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&task).Error; err != nil {
+				return err
 			}
+			return assignUsers(tx, task.ID, input.AssignedTo)
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to create task"})
+			return
 		}
 
 		// Reload task with associations
@@ -123,6 +285,8 @@ func CreateTask(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		audit.Record(db, c, audit.Entry{Action: audit.ActionTaskCreate, TargetType: audit.TargetTask, TargetID: task.ID, After: task})
+
 		c.JSON(http.StatusCreated, task)
 	}
 }
@@ -164,7 +328,8 @@ func GetTaskByID(db *gorm.DB) gin.HandlerFunc {
 
 // UpdateTask godoc
 // @Summary Memperbarui tugas
-// @Description Memperbarui informasi tugas berdasarkan ID
+// @Description Memperbarui informasi tugas berdasarkan ID. Semua field bersifat opsional. Status yang dihitung dari sub-tugas tidak dapat diubah manual (409) kecuali disable_status_rollup aktif
+// @Description Memindahkan tugas ke proyek lain atau melepasnya dari proyek (project_id 0) hanya dapat dilakukan pemilik proyek asal dan tujuan atau pengguna dengan projects.manage.any
 // @Tags Tasks
 // @Security BearerAuth
 // @Param id path int true "Task ID"
@@ -172,7 +337,9 @@ func GetTaskByID(db *gorm.DB) gin.HandlerFunc {
 // @Produce json
 // @Success 200 {object} models.Task
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
 // @Failure 404 {object} models.ErrorResponse
+// @Failure 409 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /api/tasks/{id} [put]
 func UpdateTask(db *gorm.DB) gin.HandlerFunc {
@@ -184,6 +351,13 @@ func UpdateTask(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		currentUserInterface, exists := c.Get("currentUser")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not found"})
+			return
+		}
+		currentUser := currentUserInterface.(models.User)
+
 		var input models.UpdateTaskInput
 		if err := c.ShouldBindJSON(&input); err != nil {
 			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
@@ -195,6 +369,7 @@ func UpdateTask(db *gorm.DB) gin.HandlerFunc {
 			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Task not found"})
 			return
 		}
+		before := task
 
 		// Update fields if provided
 		if input.Title != "" {
@@ -217,37 +392,102 @@ func UpdateTask(db *gorm.DB) gin.HandlerFunc {
 			}
 			task.DueDate = dueDate
 		}
+		if input.DisableStatusRollup != nil {
+			task.DisableStatusRollup = *input.DisableStatusRollup
+		}
 
-		task.UpdatedAt = time.Now()
+		// A status set by hand would be overwritten by the rollup, reject it instead of ignoring it
+		if input.Status != "" && !task.DisableStatusRollup {
+			derived, ok, err := derivedTaskStatus(db, task.ID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to check sub-tasks"})
+				return
+			}
+			if ok && derived != input.Status {
+				c.JSON(http.StatusConflict, models.ErrorResponse{Error: "Status is derived from the sub-tasks, set disable_status_rollup to change it manually"})
+				return
+			}
+		}
 
-		if err := db.Save(&task).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to update task"})
+		if err := checkAssignees(db, input.AssignedTo); err != nil {
+			assigneeErrorResponse(c, err)
 			return
 		}
 
-		// Update assignments if provided
-		if input.AssignedTo != nil {
-			// Delete existing assignments
-			db.Where("task_id = ?", task.ID).Delete(&models.TaskAssignment{})
+		if input.ProjectID != nil {
+			// A project ID of 0 removes the task from its project
+			if *input.ProjectID == 0 {
+				task.ProjectID = nil
+			} else {
+				task.ProjectID = input.ProjectID
+			}
 
-			// Assign new users
-			for _, userID := range input.AssignedTo {
-				// Check if user exists
-				var assignedUser models.User
-				if err := db.First(&assignedUser, userID).Error; err != nil {
-					c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Assigned user not found"})
-					return
+			// Moving or detaching a task needs manage rights on the project it leaves and the one it joins
+			moved := (before.ProjectID == nil) != (task.ProjectID == nil) ||
+				(before.ProjectID != nil && task.ProjectID != nil && *before.ProjectID != *task.ProjectID)
+			if moved {
+				for _, projectID := range []*uint{before.ProjectID, task.ProjectID} {
+					if projectID == nil {
+						continue
+					}
+					if err := authorizeTaskMove(db, currentUser, *projectID); err != nil {
+						projectErrorResponse(c, err)
+						return
+					}
 				}
+			}
+		}
 
-				assignment := models.TaskAssignment{
-					TaskID: task.ID,
-					UserID: userID,
+		if task.ProjectID != nil {
+			project, err := loadProjectForTask(db, currentUser, *task.ProjectID)
+			if err != nil {
+				projectErrorResponse(c, err)
+				return
+			}
+
+			assignees := input.AssignedTo
+			if assignees == nil {
+				for _, assignment := range task.AssignedTo {
+					assignees = append(assignees, assignment.UserID)
 				}
-				if err := db.Create(&assignment).Error; err != nil {
-					c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to assign user to task"})
-					return
+			}
+
+			ok, err := checkProjectAssignees(db, project, assignees)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to check project membership"})
+				return
+			}
+			if !ok {
+				c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Assigned users must be members of the project"})
+				return
+			}
+		}
+
+		task.UpdatedAt = time.Now()
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			// Save only the task's own columns, assignments are replaced below
+			if err := tx.Omit("AssignedTo").Save(&task).Error; err != nil {
+				return err
+			}
+
+			// Status stays derived from the sub-tasks unless the task opted out
+			if err := syncTaskStatus(tx, task.ID); err != nil {
+				return err
+			}
+
+			// Replace assignments if provided
+			if input.AssignedTo != nil {
+				if err := tx.Where("task_id = ?", task.ID).Delete(&models.TaskAssignment{}).Error; err != nil {
+					return err
 				}
+				return assignUsers(tx, task.ID, input.AssignedTo)
 			}
+			return nil
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to update task"})
+			return
 		}
 
 		// Reload task with associations
@@ -256,23 +496,26 @@ func UpdateTask(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		audit.Record(db, c, audit.Entry{Action: audit.ActionTaskUpdate, TargetType: audit.TargetTask, TargetID: task.ID, Before: before, After: task})
+
 		c.JSON(http.StatusOK, task)
 	}
 }
 
 // DeleteTask godoc
 // @Summary Menghapus tugas
-// @Description Menghapus tugas berdasarkan ID
+// @Description Menghapus tugas berdasarkan ID beserta komentar, sub-tugas, penugasan dan asetnya. File aset dihapus setelah tidak ada lagi aset dengan isi yang sama
 // @Tags Tasks
 // @Security BearerAuth
 // @Param id path int true "Task ID"
 // @Produce json
 // @Success 200 {object} models.SuccessResponse
 // @Failure 400 {object} models.ErrorResponse
+// @Failure 403 {object} models.ErrorResponse
 // @Failure 404 {object} models.ErrorResponse
 // @Failure 500 {object} models.ErrorResponse
 // @Router /api/tasks/{id} [delete]
-func DeleteTask(db *gorm.DB) gin.HandlerFunc {
+func DeleteTask(db *gorm.DB, store storage.Storage) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		idParam := c.Param("id")
 		id, err := strconv.Atoi(idParam)
@@ -287,11 +530,36 @@ func DeleteTask(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		if err := db.Delete(&task).Error; err != nil {
+		var unused []string
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var assets []models.Asset
+			if err := tx.Where("task_id = ?", task.ID).Find(&assets).Error; err != nil {
+				return err
+			}
+			var err error
+			if unused, err = releaseAssetFiles(tx, assets); err != nil {
+				return err
+			}
+
+			for _, model := range []interface{}{&models.Asset{}, &models.Comment{}, &models.SubTask{}, &models.TaskAssignment{}} {
+				if err := tx.Where("task_id = ?", task.ID).Delete(model).Error; err != nil {
+					return err
+				}
+			}
+			return tx.Delete(&task).Error
+		})
+		if err != nil {
 			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to delete task"})
 			return
 		}
 
+		// Only remove files once nothing can roll back to referring to them
+		for _, key := range unused {
+			deleteStoredFile(c.Request.Context(), store, key)
+		}
+
+		audit.Record(db, c, audit.Entry{Action: audit.ActionTaskDelete, TargetType: audit.TargetTask, TargetID: task.ID, Before: task})
+
 		c.JSON(http.StatusOK, models.SuccessResponse{Message: "Task deleted successfully"})
 	}
 }
@@ -0,0 +1,254 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mfuadfakhruzzaki/project/backend/audit"
+	"github.com/mfuadfakhruzzaki/project/backend/models"
+	"github.com/mfuadfakhruzzaki/project/backend/utils"
+	"gorm.io/gorm"
+)
+
+var errSessionRevoked = errors.New("session has been revoked")
+
+// issueTokens creates an access token and a refresh token for the user.
+// An empty familyID starts a new refresh token family (a new login) and with it a new session.
+func issueTokens(db *gorm.DB, c *gin.Context, user models.User, familyID string) (models.TokenResponse, *models.RefreshToken, error) {
+	var err error
+	if familyID == "" {
+		familyID, err = utils.GenerateRandomToken(16)
+		if err != nil {
+			return models.TokenResponse{}, nil, err
+		}
+	}
+
+	session, err := touchSession(db, c, user.ID, familyID)
+	if err != nil {
+		return models.TokenResponse{}, nil, err
+	}
+
+	accessToken, err := utils.GenerateToken(user.ID, user.TokenVersion, session.ID)
+	if err != nil {
+		return models.TokenResponse{}, nil, err
+	}
+
+	rawRefreshToken, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return models.TokenResponse{}, nil, err
+	}
+
+	refreshToken := models.RefreshToken{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(rawRefreshToken),
+		FamilyID:  familyID,
+		ExpiresAt: session.ExpiresAt,
+		CreatedAt: time.Now(),
+	}
+	if err := db.Create(&refreshToken).Error; err != nil {
+		return models.TokenResponse{}, nil, err
+	}
+
+	return models.TokenResponse{
+		Token:        accessToken,
+		RefreshToken: rawRefreshToken,
+		ExpiresIn:    int64(utils.GetAccessTokenTTL().Seconds()),
+	}, &refreshToken, nil
+}
+
+// touchSession returns the session of the refresh token family, creating it on the first login.
+// Every refresh records where the session was last seen and extends it by the refresh token TTL.
+func touchSession(db *gorm.DB, c *gin.Context, userID uint, familyID string) (models.Session, error) {
+	now := time.Now()
+	userAgent := c.Request.UserAgent()
+
+	var session models.Session
+	if err := db.Where("family_id = ?", familyID).Limit(1).Find(&session).Error; err != nil {
+		return session, err
+	}
+
+	if session.ID == 0 {
+		session = models.Session{
+			UserID:     userID,
+			FamilyID:   familyID,
+			Device:     utils.DescribeDevice(userAgent),
+			IP:         c.ClientIP(),
+			UserAgent:  userAgent,
+			LastSeenAt: now,
+			ExpiresAt:  now.Add(utils.GetRefreshTokenTTL()),
+			CreatedAt:  now,
+		}
+		return session, db.Create(&session).Error
+	}
+
+	if session.RevokedAt != nil {
+		return session, errSessionRevoked
+	}
+
+	session.Device = utils.DescribeDevice(userAgent)
+	session.IP = c.ClientIP()
+	session.UserAgent = userAgent
+	session.LastSeenAt = now
+	session.ExpiresAt = now.Add(utils.GetRefreshTokenTTL())
+	return session, db.Save(&session).Error
+}
+
+// revokeAllSessions invalidates every access, refresh and personal access token issued to the user
+func revokeAllSessions(db *gorm.DB, userID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).
+			Update("token_version", gorm.Expr("token_version + 1")).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Session{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.RefreshToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		// Personal access tokens don't carry the token version, a password reset must still end them
+		return tx.Model(&models.PersonalAccessToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", time.Now()).Error
+	})
+}
+
+// revokeTokenFamily ends the session of a login and revokes every refresh token descending from it
+func revokeTokenFamily(db *gorm.DB, familyID string) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Session{}).
+			Where("family_id = ? AND revoked_at IS NULL", familyID).
+			Update("revoked_at", time.Now()).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.RefreshToken{}).
+			Where("family_id = ? AND revoked_at IS NULL", familyID).
+			Update("revoked_at", time.Now()).Error
+	})
+}
+
+// RefreshToken godoc
+// @Summary Memperbarui token akses
+// @Description Menukar refresh token dengan token akses dan refresh token baru. Refresh token lama tidak dapat digunakan lagi
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param token body models.RefreshTokenInput true "Refresh Token"
+// @Success 200 {object} models.TokenResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /token/refresh [post]
+func RefreshToken(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input models.RefreshTokenInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		var refreshToken models.RefreshToken
+		if err := db.Where("token_hash = ?", utils.HashToken(input.RefreshToken)).First(&refreshToken).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "Invalid refresh token"})
+			return
+		}
+
+		// A revoked token being presented again means it was stolen or replayed,
+		// so the whole family is revoked and the user has to log in again
+		if refreshToken.RevokedAt != nil {
+			if err := revokeTokenFamily(db, refreshToken.FamilyID); err != nil {
+				c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to revoke refresh tokens"})
+				return
+			}
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "Refresh token reuse detected"})
+			return
+		}
+
+		if time.Now().After(refreshToken.ExpiresAt) {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "Refresh token expired"})
+			return
+		}
+
+		var user models.User
+		if err := db.First(&user, refreshToken.UserID).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not found"})
+			return
+		}
+
+		if !user.IsActive {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User is inactive"})
+			return
+		}
+
+		var response models.TokenResponse
+		err := db.Transaction(func(tx *gorm.DB) error {
+			var next *models.RefreshToken
+			var err error
+			response, next, err = issueTokens(tx, c, user, refreshToken.FamilyID)
+			if err != nil {
+				return err
+			}
+
+			// Only rotate if nobody else rotated this token in the meantime
+			result := tx.Model(&models.RefreshToken{}).
+				Where("id = ? AND revoked_at IS NULL", refreshToken.ID).
+				Updates(map[string]interface{}{"revoked_at": time.Now(), "replaced_by_id": next.ID})
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return gorm.ErrRecordNotFound
+			}
+			return nil
+		})
+		if errors.Is(err, gorm.ErrRecordNotFound) || errors.Is(err, errSessionRevoked) {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "Invalid refresh token"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to refresh token"})
+			return
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// Logout godoc
+// @Summary Logout pengguna
+// @Description Mencabut refresh token beserta seluruh rangkaian rotasinya sehingga sesi tidak dapat diperbarui lagi
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param token body models.RefreshTokenInput true "Refresh Token"
+// @Success 200 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /logout [post]
+func Logout(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input models.RefreshTokenInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		// Unknown tokens are ignored so the endpoint can't be used to probe for valid tokens
+		var refreshToken models.RefreshToken
+		if err := db.Where("token_hash = ?", utils.HashToken(input.RefreshToken)).First(&refreshToken).Error; err == nil {
+			if err := revokeTokenFamily(db, refreshToken.FamilyID); err != nil {
+				c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to logout"})
+				return
+			}
+			audit.Record(db, c, audit.Entry{ActorID: &refreshToken.UserID, Action: audit.ActionLogout, TargetType: audit.TargetUser, TargetID: refreshToken.UserID})
+		}
+
+		c.JSON(http.StatusOK, models.SuccessResponse{Message: "Logged out successfully"})
+	}
+}
@@ -0,0 +1,288 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mfuadfakhruzzaki/project/backend/audit"
+	"github.com/mfuadfakhruzzaki/project/backend/models"
+	"github.com/mfuadfakhruzzaki/project/backend/utils"
+	"gorm.io/gorm"
+)
+
+const recoveryCodeCount = 10
+
+// recoveryCodeAlphabet has 32 characters and leaves out easily confused ones (0/o, 1/l)
+const recoveryCodeAlphabet = "abcdefghijkmnpqrstuvwxyz23456789"
+
+// normalizeRecoveryCode strips formatting so codes can be typed with or without dashes
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	code = strings.ReplaceAll(code, "-", "")
+	return strings.ReplaceAll(code, " ", "")
+}
+
+// generateRecoveryCodes replaces the user's recovery codes and returns the new plain codes
+func generateRecoveryCodes(db *gorm.DB, userID uint) ([]string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	records := make([]models.RecoveryCode, 0, recoveryCodeCount)
+
+	for i := 0; i < recoveryCodeCount; i++ {
+		raw := make([]byte, 10)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, err
+		}
+		for j := range raw {
+			raw[j] = recoveryCodeAlphabet[raw[j]&31]
+		}
+		code := string(raw[:5]) + "-" + string(raw[5:])
+
+		codes = append(codes, code)
+		records = append(records, models.RecoveryCode{
+			UserID:    userID,
+			CodeHash:  utils.HashToken(normalizeRecoveryCode(code)),
+			CreatedAt: time.Now(),
+		})
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&records).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// consumeTOTPCode validates a TOTP code and records its time step so the same code can't be replayed
+func consumeTOTPCode(db *gorm.DB, user models.User, code string) (bool, error) {
+	step, ok := utils.ValidateTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	result := db.Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", user.ID, step).
+		Update("totp_last_step", step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// consumeRecoveryCode marks a matching unused recovery code as used
+func consumeRecoveryCode(db *gorm.DB, userID uint, code string) (bool, error) {
+	result := db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, utils.HashToken(normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// EnrollTOTP godoc
+// @Summary Memulai pendaftaran 2FA
+// @Description Membuat secret TOTP baru dan mengembalikan URI otpauth untuk dipindai aplikasi autentikator. 2FA baru aktif setelah dikonfirmasi
+// @Tags Two-Factor Authentication
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} models.TOTPEnrollmentResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /profile/2fa/enroll [post]
+func EnrollTOTP(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		currentUserInterface, exists := c.Get("currentUser")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not found"})
+			return
+		}
+
+		user := currentUserInterface.(models.User)
+
+		if user.TOTPEnabled {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Two-factor authentication is already enabled"})
+			return
+		}
+
+		secret, err := utils.GenerateTOTPSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to generate secret"})
+			return
+		}
+
+		// The secret stays pending until the user confirms it with a valid code
+		if err := db.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]interface{}{
+			"totp_secret":    secret,
+			"totp_last_step": 0,
+		}).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to save secret"})
+			return
+		}
+
+		c.JSON(http.StatusOK, models.TOTPEnrollmentResponse{
+			Secret:     secret,
+			OTPAuthURI: utils.TOTPURI(utils.GetTOTPIssuer(), user.Email, secret),
+		})
+	}
+}
+
+// ConfirmTOTP godoc
+// @Summary Mengonfirmasi pendaftaran 2FA
+// @Description Mengaktifkan 2FA setelah kode TOTP valid dimasukkan dan mengembalikan kode pemulihan sekali pakai. Kode pemulihan hanya ditampilkan sekali
+// @Tags Two-Factor Authentication
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param input body models.TOTPCodeInput true "TOTP Code"
+// @Success 200 {object} models.RecoveryCodesResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /profile/2fa/confirm [post]
+func ConfirmTOTP(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input models.TOTPCodeInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		currentUserInterface, exists := c.Get("currentUser")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not found"})
+			return
+		}
+
+		user := currentUserInterface.(models.User)
+
+		if user.TOTPEnabled {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Two-factor authentication is already enabled"})
+			return
+		}
+		if user.TOTPSecret == "" {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Start the enrollment first"})
+			return
+		}
+
+		ok, err := consumeTOTPCode(db, user, input.Code)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to verify code"})
+			return
+		}
+		if !ok {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid code"})
+			return
+		}
+
+		codes, err := generateRecoveryCodes(db, user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to generate recovery codes"})
+			return
+		}
+
+		if err := db.Model(&models.User{}).Where("id = ?", user.ID).Update("totp_enabled", true).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to enable two-factor authentication"})
+			return
+		}
+
+		audit.Record(db, c, audit.Entry{Action: audit.ActionTwoFactorEnabled, TargetType: audit.TargetUser, TargetID: user.ID})
+
+		c.JSON(http.StatusOK, models.RecoveryCodesResponse{RecoveryCodes: codes})
+	}
+}
+
+// LoginTwoFactor godoc
+// @Summary Login langkah kedua (2FA)
+// @Description Menyelesaikan login dengan challenge token dari /login dan kode TOTP atau kode pemulihan
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param input body models.TwoFactorLoginInput true "Two-Factor Login Input"
+// @Success 200 {object} models.TokenResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /login/2fa [post]
+func LoginTwoFactor(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input models.TwoFactorLoginInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		if input.Code == "" && input.RecoveryCode == "" {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Code or recovery code is required"})
+			return
+		}
+
+		claims, err := utils.ParseTwoFactorChallenge(input.ChallengeToken)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "Invalid or expired challenge"})
+			return
+		}
+
+		var user models.User
+		if err := db.Preload("Role").First(&user, claims.UserID).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "Invalid or expired challenge"})
+			return
+		}
+
+		if !user.IsActive {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User is inactive"})
+			return
+		}
+
+		// The challenge is bound to the sessions that existed when it was issued
+		if claims.TokenVersion != user.TokenVersion || !user.TOTPEnabled {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "Invalid or expired challenge"})
+			return
+		}
+
+		// Wrong codes count towards the same lockout as wrong passwords
+		if !checkLoginThrottle(db, c, user.Email) {
+			return
+		}
+
+		var ok bool
+		if input.Code != "" {
+			ok, err = consumeTOTPCode(db, user, input.Code)
+		} else {
+			ok, err = consumeRecoveryCode(db, user.ID, input.RecoveryCode)
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to verify code"})
+			return
+		}
+		if !ok {
+			recordLoginFailure(db, c, user.ID, user.Email, "invalid_2fa_code")
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "Invalid code"})
+			return
+		}
+
+		tokens, _, err := issueTokens(db, c, user, "")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to generate token"})
+			return
+		}
+
+		if err := clearLoginThrottle(db, accountThrottleKey(user.Email)); err != nil {
+			log.Printf("failed to reset login attempts: %v", err)
+		}
+		audit.Record(db, c, audit.Entry{ActorID: &user.ID, Action: audit.ActionLogin, TargetType: audit.TargetUser, TargetID: user.ID})
+
+		c.JSON(http.StatusOK, tokens)
+	}
+}
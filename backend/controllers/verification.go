@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mfuadfakhruzzaki/project/backend/audit"
+	"github.com/mfuadfakhruzzaki/project/backend/mailer"
+	"github.com/mfuadfakhruzzaki/project/backend/models"
+	"github.com/mfuadfakhruzzaki/project/backend/utils"
+	"gorm.io/gorm"
+)
+
+// sendVerificationEmail issues a new verification token for the user's current email and mails it.
+// Previously issued tokens are discarded.
+func sendVerificationEmail(db *gorm.DB, m mailer.Mailer, user models.User) error {
+	rawToken, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return err
+	}
+
+	verificationToken := models.EmailVerificationToken{
+		UserID:    user.ID,
+		TokenHash: utils.HashToken(rawToken),
+		ExpiresAt: time.Now().Add(utils.GetEmailVerificationTokenTTL()),
+		CreatedAt: time.Now(),
+	}
+
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND used_at IS NULL", user.ID).Delete(&models.EmailVerificationToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&verificationToken).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	link := utils.GetAppURL() + "/verify-email?token=" + rawToken
+	return m.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: "Hi " + user.Username + ",\n\n" +
+			"Please confirm your email address by opening the link below. It expires in " + utils.GetEmailVerificationTokenTTL().String() + ".\n\n" +
+			link + "\n",
+	})
+}
+
+// VerifyEmail godoc
+// @Summary Verifikasi email
+// @Description Memverifikasi alamat email pengguna menggunakan token yang dikirim melalui email
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param input body models.VerifyEmailInput true "Verify Email Input"
+// @Success 200 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /email/verify [post]
+func VerifyEmail(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input models.VerifyEmailInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: err.Error()})
+			return
+		}
+
+		var verificationToken models.EmailVerificationToken
+		if err := db.Where("token_hash = ? AND used_at IS NULL", utils.HashToken(input.Token)).First(&verificationToken).Error; err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid or expired verification token"})
+			return
+		}
+
+		if time.Now().After(verificationToken.ExpiresAt) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid or expired verification token"})
+			return
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			now := time.Now()
+			result := tx.Model(&models.EmailVerificationToken{}).
+				Where("id = ? AND used_at IS NULL", verificationToken.ID).
+				Update("used_at", now)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return gorm.ErrRecordNotFound
+			}
+
+			return tx.Model(&models.User{}).Where("id = ?", verificationToken.UserID).Updates(map[string]interface{}{
+				"email_verified_at": now,
+				"updated_at":        now,
+			}).Error
+		})
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid or expired verification token"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to verify email"})
+			return
+		}
+
+		audit.Record(db, c, audit.Entry{ActorID: &verificationToken.UserID, Action: audit.ActionEmailVerified, TargetType: audit.TargetUser, TargetID: verificationToken.UserID})
+
+		c.JSON(http.StatusOK, models.SuccessResponse{Message: "Email verified successfully"})
+	}
+}
+
+// ResendVerificationEmail godoc
+// @Summary Kirim ulang email verifikasi
+// @Description Mengirim ulang email verifikasi untuk pengguna yang sedang login. Dibatasi agar tidak dapat dikirim terlalu sering
+// @Tags Auth
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} models.SuccessResponse
+// @Failure 400 {object} models.ErrorResponse
+// @Failure 401 {object} models.ErrorResponse
+// @Failure 429 {object} models.ErrorResponse
+// @Failure 500 {object} models.ErrorResponse
+// @Router /email/verify/resend [post]
+func ResendVerificationEmail(db *gorm.DB, m mailer.Mailer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		currentUserInterface, exists := c.Get("currentUser")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not found"})
+			return
+		}
+
+		user := currentUserInterface.(models.User)
+
+		if user.EmailVerifiedAt != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Email already verified"})
+			return
+		}
+
+		// Throttle based on when the last token was issued
+		var lastToken models.EmailVerificationToken
+		if err := db.Where("user_id = ?", user.ID).Order("created_at DESC").First(&lastToken).Error; err == nil {
+			wait := time.Until(lastToken.CreatedAt.Add(utils.GetEmailVerificationResendInterval()))
+			if wait > 0 {
+				c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+				c.JSON(http.StatusTooManyRequests, models.ErrorResponse{Error: "Verification email was sent recently, please try again later"})
+				return
+			}
+		}
+
+		if err := sendVerificationEmail(db, m, user); err != nil {
+			c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to send verification email"})
+			return
+		}
+
+		c.JSON(http.StatusOK, models.SuccessResponse{Message: "Verification email sent"})
+	}
+}
@@ -0,0 +1,98 @@
+package mailer
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"strings"
+)
+
+// Message is a plain-text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers email messages
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// NewFromEnv returns the mailer selected by MAIL_DRIVER ("smtp" or "log"). Without MAIL_DRIVER the log
+// mailer is used, except in release builds: it would write live reset links to the application log.
+func NewFromEnv(release bool) (Mailer, error) {
+	switch driver := os.Getenv("MAIL_DRIVER"); driver {
+	case "smtp":
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "25"
+		}
+		from := os.Getenv("MAIL_FROM")
+		if from == "" {
+			from = "no-reply@localhost"
+		}
+		return &SMTPMailer{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}, nil
+	case "log":
+		return &LogMailer{}, nil
+	case "":
+		if release {
+			return nil, errors.New("MAIL_DRIVER must be set in release mode")
+		}
+		log.Println("MAIL_DRIVER is not configured, emails are written to the log")
+		return &LogMailer{}, nil
+	default:
+		return nil, fmt.Errorf("unknown MAIL_DRIVER %q", driver)
+	}
+}
+
+// SMTPMailer sends email through an SMTP server. Authentication is skipped when
+// Username is empty, which is what local sinks such as MailHog expect.
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+// Send delivers the message through the configured SMTP server
+func (m *SMTPMailer) Send(msg Message) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	// Strip line breaks from header values to prevent header injection
+	headerValue := strings.NewReplacer("\r", "", "\n", "")
+
+	body := "From: " + headerValue.Replace(m.From) + "\r\n" +
+		"To: " + headerValue.Replace(msg.To) + "\r\n" +
+		"Subject: " + headerValue.Replace(msg.Subject) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=\"utf-8\"\r\n" +
+		"\r\n" + msg.Body
+
+	if err := smtp.SendMail(m.Host+":"+m.Port, auth, m.From, []string{msg.To}, []byte(body)); err != nil {
+		return fmt.Errorf("send mail to %s: %w", msg.To, err)
+	}
+	return nil
+}
+
+// LogMailer writes messages to the application log instead of sending them.
+// It is meant for development.
+type LogMailer struct{}
+
+// Send logs the message
+func (m *LogMailer) Send(msg Message) error {
+	log.Printf("mail to=%q subject=%q\n%s", msg.To, msg.Subject, msg.Body)
+	return nil
+}
@@ -3,15 +3,19 @@ package middlewares
 
 import (
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/mfuadfakhruzzaki/project/backend/audit"
 	"github.com/mfuadfakhruzzaki/project/backend/models"
+	"github.com/mfuadfakhruzzaki/project/backend/policies"
 	"github.com/mfuadfakhruzzaki/project/backend/utils"
 	"gorm.io/gorm"
 )
 
-// AuthMiddleware verifies the JWT token and sets the current user in context
+// AuthMiddleware verifies the JWT token or personal access token and sets the current user in context
 func AuthMiddleware(db *gorm.DB) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
@@ -29,7 +33,12 @@ func AuthMiddleware(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		tokenStr := parts[1]
-		userID, err := utils.ParseToken(tokenStr)
+		if strings.HasPrefix(tokenStr, utils.PersonalAccessTokenPrefix) {
+			authenticatePersonalAccessToken(c, db, tokenStr)
+			return
+		}
+
+		claims, err := utils.ParseToken(tokenStr)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "Invalid token"})
 			c.Abort()
@@ -37,7 +46,7 @@ func AuthMiddleware(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		var user models.User
-		if err := db.Preload("Role").First(&user, userID).Error; err != nil {
+		if err := db.Preload("Role.Permissions").First(&user, claims.UserID).Error; err != nil {
 			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not found"})
 			c.Abort()
 			return
@@ -49,13 +58,158 @@ func AuthMiddleware(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Tokens issued before the user's sessions were revoked are no longer valid
+		if claims.TokenVersion != user.TokenVersion {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "Token has been revoked"})
+			c.Abort()
+			return
+		}
+
+		// Impersonation tokens live in the admin's session and only as long as the admin may impersonate
+		sessionUserID := user.ID
+		var impersonator *models.User
+		if claims.ImpersonatorID != 0 {
+			var admin models.User
+			if err := db.Preload("Role.Permissions").First(&admin, claims.ImpersonatorID).Error; err != nil ||
+				!admin.IsActive || !policies.HasPermission(admin, policies.PermUsersImpersonate) {
+				c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "Impersonation is no longer allowed"})
+				c.Abort()
+				return
+			}
+			impersonator = &admin
+			sessionUserID = admin.ID
+		}
+
+		// Signing out a session remotely takes effect immediately, not when the access token expires
+		var session models.Session
+		if err := db.Where("id = ? AND user_id = ?", claims.SessionID, sessionUserID).First(&session).Error; err != nil || session.RevokedAt != nil {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "Session has been revoked"})
+			c.Abort()
+			return
+		}
+
+		// Last seen is only approximate, writing it on every request would be wasteful
+		if time.Since(session.LastSeenAt) > time.Minute {
+			db.Model(&session).UpdateColumns(map[string]interface{}{"last_seen_at": time.Now(), "ip": c.ClientIP()})
+		}
+
 		c.Set("currentUser", user)
+		c.Set("sessionID", session.ID)
+
+		if impersonator != nil {
+			impersonate(c, db, *impersonator, user)
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// impersonate runs a request made by an admin acting as user. Only reads are allowed unless writes
+// were enabled, deletes never are, and every request is written to the audit log.
+func impersonate(c *gin.Context, db *gorm.DB, admin models.User, user models.User) {
+	c.Set("impersonator", admin)
+	c.Header("X-Impersonated-By", strconv.FormatUint(uint64(admin.ID), 10))
+
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		c.Next()
+	case http.MethodDelete:
+		c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "Impersonation tokens cannot delete data"})
+		c.Abort()
+	default:
+		if utils.ImpersonationAllowsWrites() {
+			c.Next()
+		} else {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "Impersonation tokens are read-only"})
+			c.Abort()
+		}
+	}
+
+	audit.Record(db, c, audit.Entry{
+		Action:     audit.ActionImpersonatedRequest,
+		TargetType: audit.TargetUser,
+		TargetID:   user.ID,
+		After: map[string]interface{}{
+			"method": c.Request.Method,
+			"path":   c.Request.URL.Path,
+			"status": c.Writer.Status(),
+		},
+	})
+}
+
+// authenticatePersonalAccessToken authenticates a request made with a personal access token.
+// The token's scopes are stored in the context for RequireScope.
+func authenticatePersonalAccessToken(c *gin.Context, db *gorm.DB, tokenStr string) {
+	var token models.PersonalAccessToken
+	if err := db.Where("token_hash = ? AND revoked_at IS NULL", utils.HashToken(tokenStr)).First(&token).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "Invalid token"})
+		c.Abort()
+		return
+	}
+
+	if time.Now().After(token.ExpiresAt) {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "Token expired"})
+		c.Abort()
+		return
+	}
+
+	var user models.User
+	if err := db.Preload("Role.Permissions").First(&user, token.UserID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not found"})
+		c.Abort()
+		return
+	}
+
+	if !user.IsActive {
+		c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User is inactive"})
+		c.Abort()
+		return
+	}
+
+	db.Model(&token).UpdateColumn("last_used_at", time.Now())
+
+	c.Set("currentUser", user)
+	c.Set("tokenScopes", strings.Fields(token.Scopes))
+	c.Next()
+}
+
+// RequireScope rejects personal access tokens that were not granted the scope.
+// Regular logins are not limited by scopes.
+func RequireScope(scope policies.Scope) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		scopes, ok := c.Get("tokenScopes")
+		if ok && !policies.HasScope(scopes.([]string), scope) {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "Token is missing the " + string(scope) + " scope"})
+			c.Abort()
+			return
+		}
+
 		c.Next()
 	}
 }
 
-// AdminMiddleware ensures that the user has admin privileges
-func AdminMiddleware() gin.HandlerFunc {
+// RequireSession rejects personal access tokens and impersonation tokens, for actions that need
+// the user's own interactive login such as managing credentials or other tokens
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("tokenScopes"); ok {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "Personal access tokens cannot be used for this action"})
+			c.Abort()
+			return
+		}
+		if _, ok := c.Get("impersonator"); ok {
+			c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "Impersonation tokens cannot be used for this action"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequirePermission ensures that the user's role grants all of the permissions
+func RequirePermission(permissions ...policies.Permission) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		currentUser, exists := c.Get("currentUser")
 		if !exists {
@@ -65,12 +219,14 @@ func AdminMiddleware() gin.HandlerFunc {
 		}
 
 		user := currentUser.(models.User)
-		if user.Role.Name != "admin" {
-			c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "Admin access required"})
-			c.Abort()
-			return
+		for _, permission := range permissions {
+			if !policies.HasPermission(user, permission) {
+				c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "Missing permission: " + string(permission)})
+				c.Abort()
+				return
+			}
 		}
 
 		c.Next()
 	}
-}
\ No newline at end of file
+}
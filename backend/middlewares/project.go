@@ -0,0 +1,57 @@
+package middlewares
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mfuadfakhruzzaki/project/backend/models"
+	"github.com/mfuadfakhruzzaki/project/backend/policies"
+	"gorm.io/gorm"
+)
+
+// ProjectAccessMiddleware loads the project from the :id parameter and enforces the project access policy
+// for the given action. The loaded project is stored in the context under "project".
+func ProjectAccessMiddleware(db *gorm.DB, action policies.ProjectAction) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid project ID"})
+			c.Abort()
+			return
+		}
+
+		currentUser, exists := c.Get("currentUser")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not found"})
+			c.Abort()
+			return
+		}
+
+		user := currentUser.(models.User)
+
+		var project models.Project
+		if err := db.First(&project, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Project not found"})
+			c.Abort()
+			return
+		}
+
+		if err := policies.AuthorizeProject(db, user, project, action); err != nil {
+			switch {
+			case errors.Is(err, policies.ErrProjectHidden):
+				c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Project not found"})
+			case errors.Is(err, policies.ErrProjectForbidden):
+				c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "Only the project owner can perform this action"})
+			default:
+				c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to check project permissions"})
+			}
+			c.Abort()
+			return
+		}
+
+		c.Set("project", project)
+		c.Next()
+	}
+}
@@ -0,0 +1,58 @@
+package middlewares
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/mfuadfakhruzzaki/project/backend/models"
+	"github.com/mfuadfakhruzzaki/project/backend/policies"
+	"gorm.io/gorm"
+)
+
+// TaskAccessMiddleware loads the task from the :id parameter and enforces the task access policy
+// for the given action. The loaded task is stored in the context under "task".
+func TaskAccessMiddleware(db *gorm.DB, action policies.TaskAction) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, models.ErrorResponse{Error: "Invalid task ID"})
+			c.Abort()
+			return
+		}
+
+		currentUser, exists := c.Get("currentUser")
+		if !exists {
+			c.JSON(http.StatusUnauthorized, models.ErrorResponse{Error: "User not found"})
+			c.Abort()
+			return
+		}
+
+		user := currentUser.(models.User)
+
+		var task models.Task
+		if err := db.First(&task, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Task not found"})
+			c.Abort()
+			return
+		}
+
+		if err := policies.AuthorizeTask(db, user, task, action); err != nil {
+			switch {
+			case errors.Is(err, policies.ErrTaskHidden):
+				// Same response as a missing task so IDs cannot be probed
+				c.JSON(http.StatusNotFound, models.ErrorResponse{Error: "Task not found"})
+			case errors.Is(err, policies.ErrTaskForbidden):
+				c.JSON(http.StatusForbidden, models.ErrorResponse{Error: "You do not have permission to perform this action on the task"})
+			default:
+				c.JSON(http.StatusInternalServerError, models.ErrorResponse{Error: "Failed to check task permissions"})
+			}
+			c.Abort()
+			return
+		}
+
+		c.Set("task", task)
+		c.Next()
+	}
+}
@@ -2,44 +2,238 @@
 package models
 
 import (
+	"errors"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 // Role represents the user roles in the system
 type Role struct {
-	ID   uint   `json:"id" gorm:"primaryKey"`
-	Name string `json:"name" binding:"required"`
+	ID          uint         `json:"id" gorm:"primaryKey"`
+	Name        string       `json:"name" gorm:"uniqueIndex" binding:"required"`
+	Description string       `json:"description"`
+	Permissions []Permission `json:"permissions,omitempty" gorm:"many2many:role_permissions"`
+}
+
+// Permission is a named capability that can be granted to roles
+type Permission struct {
+	ID          uint   `json:"id" gorm:"primaryKey"`
+	Name        string `json:"name" gorm:"uniqueIndex"`
+	Description string `json:"description"`
 }
 
 // User represents a user in the system
 type User struct {
-	ID        uint      `json:"id" gorm:"primaryKey"`
-	Username  string    `json:"username" binding:"required"`
-	Email     string    `json:"email" gorm:"unique" binding:"required,email"`
-	Password  string    `json:"-" binding:"required,min=6"`
-	IsActive  bool      `json:"is_active"`
-	RoleID    uint      `json:"role_id"`
-	Role      Role      `json:"role" gorm:"foreignKey:RoleID"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID              uint       `json:"id" gorm:"primaryKey"`
+	Username        string     `json:"username" binding:"required"`
+	Email           string     `json:"email" gorm:"unique" binding:"required,email"`
+	Password        string     `json:"-" binding:"required,min=6"`
+	IsActive        bool       `json:"is_active"`
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	TOTPEnabled     bool       `json:"totp_enabled"`
+	TOTPSecret      string     `json:"-"`
+	TOTPLastStep    int64      `json:"-"`
+	TokenVersion    uint       `json:"-"`
+	RoleID          uint       `json:"role_id"`
+	Role            Role       `json:"role" gorm:"foreignKey:RoleID"`
+	CreatedAt       time.Time  `json:"created_at"`
+	UpdatedAt       time.Time  `json:"updated_at"`
 }
 
 // Task represents a task in the system
 type Task struct {
-	ID          uint             `json:"id" gorm:"primaryKey"`
-	Title       string           `json:"title" binding:"required"`
-	Description string           `json:"description"`
-	Priority    string           `json:"priority" binding:"oneof=high medium normal low"`
-	Status      string           `json:"status" binding:"oneof=todo in_progress completed"`
-	DueDate     time.Time        `json:"due_date" binding:"required"`
-	CreatedBy   uint             `json:"created_by"`
-	Creator     User             `json:"creator" gorm:"foreignKey:CreatedBy"`
-	AssignedTo  []TaskAssignment `json:"assigned_to" gorm:"foreignKey:TaskID"`
-	Comments    []Comment        `json:"comments" gorm:"foreignKey:TaskID"`
-	Assets      []Asset          `json:"assets" gorm:"foreignKey:TaskID"`
-	SubTasks    []SubTask        `json:"sub_tasks" gorm:"foreignKey:TaskID"`
-	CreatedAt   time.Time        `json:"created_at"`
-	UpdatedAt   time.Time        `json:"updated_at"`
+	ID                  uint             `json:"id" gorm:"primaryKey"`
+	Title               string           `json:"title" binding:"required"`
+	Description         string           `json:"description"`
+	Priority            string           `json:"priority" binding:"oneof=high medium normal low"`
+	Status              string           `json:"status" binding:"oneof=todo in_progress completed"`
+	DueDate             time.Time        `json:"due_date" binding:"required"`
+	DisableStatusRollup bool             `json:"disable_status_rollup"`
+	ProjectID           *uint            `json:"project_id" gorm:"index"`
+	CreatedBy           uint             `json:"created_by"`
+	Creator             User             `json:"creator" gorm:"foreignKey:CreatedBy"`
+	AssignedTo          []TaskAssignment `json:"assigned_to" gorm:"foreignKey:TaskID"`
+	Comments            []Comment        `json:"comments" gorm:"foreignKey:TaskID"`
+	Assets              []Asset          `json:"assets" gorm:"foreignKey:TaskID"`
+	SubTasks            []SubTask        `json:"sub_tasks" gorm:"foreignKey:TaskID"`
+	CreatedAt           time.Time        `json:"created_at"`
+	UpdatedAt           time.Time        `json:"updated_at"`
+}
+
+// Project represents a container that groups tasks and the users working on them
+type Project struct {
+	ID          uint            `json:"id" gorm:"primaryKey"`
+	Name        string          `json:"name" binding:"required"`
+	Description string          `json:"description"`
+	OwnerID     uint            `json:"owner_id"`
+	Owner       User            `json:"owner" gorm:"foreignKey:OwnerID"`
+	Members     []ProjectMember `json:"members" gorm:"foreignKey:ProjectID"`
+	IsArchived  bool            `json:"is_archived"`
+	ArchivedAt  *time.Time      `json:"archived_at"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// ProjectMember represents the membership of a user in a project
+type ProjectMember struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	ProjectID uint      `json:"project_id" gorm:"uniqueIndex:idx_project_member"`
+	UserID    uint      `json:"user_id" gorm:"uniqueIndex:idx_project_member"`
+	User      User      `json:"user" gorm:"foreignKey:UserID"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RefreshToken represents a rotating refresh token. Tokens issued from the same login share a FamilyID
+// so that the whole chain can be revoked when a rotated token is reused.
+type RefreshToken struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	UserID       uint       `json:"user_id" gorm:"index"`
+	TokenHash    string     `json:"-" gorm:"uniqueIndex"`
+	FamilyID     string     `json:"-" gorm:"index"`
+	ExpiresAt    time.Time  `json:"expires_at"`
+	RevokedAt    *time.Time `json:"revoked_at"`
+	ReplacedByID *uint      `json:"replaced_by_id"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// Session is a login on one device. It lives as long as its refresh token family.
+type Session struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"user_id" gorm:"index"`
+	FamilyID   string     `json:"-" gorm:"uniqueIndex"`
+	Device     string     `json:"device"`
+	IP         string     `json:"ip"`
+	UserAgent  string     `json:"user_agent"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// Invitation lets someone create an account with a pre-assigned role while registration is closed.
+// Invitations sent by project owners also add the new user to the project.
+type Invitation struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	Email       string     `json:"email" gorm:"index"`
+	TokenHash   string     `json:"-" gorm:"uniqueIndex"`
+	RoleID      uint       `json:"role_id"`
+	Role        Role       `json:"role" gorm:"foreignKey:RoleID"`
+	ProjectID   *uint      `json:"project_id" gorm:"index"`
+	InvitedByID uint       `json:"invited_by_id"`
+	ExpiresAt   time.Time  `json:"expires_at"`
+	AcceptedAt  *time.Time `json:"accepted_at"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// PasswordResetToken represents a single-use token for resetting a forgotten password
+type PasswordResetToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"index"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// EmailVerificationToken represents a single-use token proving ownership of an email address
+type EmailVerificationToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"index"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// RecoveryCode represents a one-time code that can replace a TOTP code when the device is lost
+type RecoveryCode struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UserID    uint       `json:"user_id" gorm:"index"`
+	CodeHash  string     `json:"-" gorm:"index"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// UserIdentity links a user to an account at an external OpenID Connect provider
+type UserIdentity struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"index"`
+	Issuer    string    `json:"issuer" gorm:"uniqueIndex:idx_identity_issuer_subject"`
+	Subject   string    `json:"subject" gorm:"uniqueIndex:idx_identity_issuer_subject"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OIDCLoginState keeps the state, nonce and PKCE verifier of a pending OpenID Connect login
+type OIDCLoginState struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	StateHash    string    `json:"-" gorm:"uniqueIndex"`
+	Nonce        string    `json:"-"`
+	CodeVerifier string    `json:"-"`
+	ExpiresAt    time.Time `json:"expires_at" gorm:"index"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// LoginThrottle counts recent failed logins for an account or client IP
+type LoginThrottle struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	Key           string     `json:"key" gorm:"uniqueIndex;not null"`
+	Failures      int        `json:"failures"`
+	LastFailureAt time.Time  `json:"last_failure_at"`
+	LockedUntil   *time.Time `json:"locked_until"`
+}
+
+// RoleChange records a change of a user's role and the admin who made it
+type RoleChange struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	UserID      uint      `json:"user_id" gorm:"index"`
+	OldRoleID   uint      `json:"old_role_id"`
+	NewRoleID   uint      `json:"new_role_id"`
+	ChangedByID uint      `json:"changed_by_id"` // 0 when the role was synced from the identity provider
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// AuditLog records who did what to which record. Entries are append-only.
+type AuditLog struct {
+	ID      uint  `json:"id" gorm:"primaryKey"`
+	ActorID *uint `json:"actor_id" gorm:"index"`
+	// ImpersonatorID is the admin who acted as the actor, if any
+	ImpersonatorID *uint     `json:"impersonator_id" gorm:"index"`
+	Action         string    `json:"action" gorm:"index;not null"`
+	TargetType     string    `json:"target_type" gorm:"index:idx_audit_target"`
+	TargetID       uint      `json:"target_id" gorm:"index:idx_audit_target"`
+	Changes        string    `json:"changes" gorm:"type:text"`
+	IP             string    `json:"ip"`
+	UserAgent      string    `json:"user_agent"`
+	CreatedAt      time.Time `json:"created_at" gorm:"index"`
+}
+
+// ErrAuditLogAppendOnly is returned when something tries to change or remove an audit log entry
+var ErrAuditLogAppendOnly = errors.New("audit log entries are append-only")
+
+// BeforeUpdate keeps audit log entries from being modified through GORM
+func (AuditLog) BeforeUpdate(*gorm.DB) error {
+	return ErrAuditLogAppendOnly
+}
+
+// BeforeDelete keeps audit log entries from being removed through GORM
+func (AuditLog) BeforeDelete(*gorm.DB) error {
+	return ErrAuditLogAppendOnly
+}
+
+// PersonalAccessToken is a long-lived, scoped token for scripts and CI. Only its hash is stored.
+type PersonalAccessToken struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	UserID     uint       `json:"user_id" gorm:"index"`
+	Name       string     `json:"name" gorm:"not null"`
+	TokenHash  string     `json:"-" gorm:"uniqueIndex;not null"`
+	Scopes     string     `json:"-" gorm:"not null"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
 }
 
 // TaskAssignment represents the assignment of a task to a user
@@ -50,23 +244,48 @@ type TaskAssignment struct {
 	User   User `json:"user" gorm:"foreignKey:UserID"`
 }
 
-// Asset represents an asset associated with a task
+// Asset represents an asset associated with a task. StorageKey locates the file in the configured storage
+// backend and is generated by the server, OriginalFilename is the name the file was uploaded with.
 type Asset struct {
+	ID               uint      `json:"id" gorm:"primaryKey"`
+	StorageKey       string    `json:"storage_key"`
+	OriginalFilename string    `json:"original_filename"`
+	Size             int64     `json:"size"`
+	MimeType         string    `json:"mime_type"`
+	Checksum         string    `json:"checksum"` // hex encoded SHA-256 of the content
+	BlobID           *uint     `json:"blob_id" gorm:"index"`
+	Description      string    `json:"description"`
+	TaskID           uint      `json:"task_id"`
+	UploadedBy       uint      `json:"uploaded_by"`
+	Uploader         User      `json:"uploader" gorm:"foreignKey:UploadedBy"`
+	UploadedAt       time.Time `json:"uploaded_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// Blob is a stored file shared by every asset with the same content. RefCount is the number of
+// assets using it, the file is removed when it drops to zero. Assets uploaded before
+// deduplication have no blob and own their file.
+type Blob struct {
 	ID         uint      `json:"id" gorm:"primaryKey"`
-	FilePath   string    `json:"file_path"`
-	TaskID     uint      `json:"task_id"`
-	UploadedBy uint      `json:"uploaded_by"`
-	UploadedAt time.Time `json:"uploaded_at"`
+	Checksum   string    `json:"checksum" gorm:"uniqueIndex"` // hex encoded SHA-256 of the content
+	StorageKey string    `json:"storage_key"`
+	Size       int64     `json:"size"`
+	MimeType   string    `json:"mime_type"`
+	RefCount   int       `json:"ref_count"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
 }
 
 // Comment represents a comment on a task
 type Comment struct {
-	ID        uint      `json:"id" gorm:"primaryKey"`
-	Content   string    `json:"content" binding:"required"`
-	TaskID    uint      `json:"task_id"`
-	UserID    uint      `json:"user_id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	Content   string     `json:"content" binding:"required"`
+	TaskID    uint       `json:"task_id"`
+	UserID    uint       `json:"user_id"`
+	User      User       `json:"user" gorm:"foreignKey:UserID"`
+	EditedAt  *time.Time `json:"edited_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
 }
 
 // SubTask represents a sub-task within a main task
@@ -78,6 +297,7 @@ type SubTask struct {
 	Status      string    `json:"status" binding:"oneof=todo in_progress completed"`
 	DueDate     time.Time `json:"due_date" binding:"required"`
 	TaskID      uint      `json:"task_id"`
+	Position    int       `json:"position"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
@@ -96,14 +316,125 @@ type SuccessResponse struct {
 
 // TokenResponse represents the structure of JWT token responses
 type TokenResponse struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// ImpersonationResponse contains a token that acts as another user. There is no refresh token, a new one has to be requested when it expires.
+type ImpersonationResponse struct {
+	Token     string `json:"token"`
+	ExpiresIn int64  `json:"expires_in"`
+	ReadOnly  bool   `json:"read_only"`
+	User      User   `json:"user"`
+}
+
+// TwoFactorChallengeResponse is returned by login when the user has two-factor authentication enabled
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired bool   `json:"two_factor_required"`
+	ChallengeToken    string `json:"challenge_token"`
+}
+
+// TwoFactorLoginInput represents the second step of a two-factor login.
+// Either a TOTP code or a recovery code must be given.
+type TwoFactorLoginInput struct {
+	ChallengeToken string `json:"challenge_token" binding:"required"`
+	Code           string `json:"code"`
+	RecoveryCode   string `json:"recovery_code"`
+}
+
+// TOTPEnrollmentResponse contains the secret for a pending TOTP enrollment
+type TOTPEnrollmentResponse struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauth_uri"`
+}
+
+// TOTPCodeInput represents a TOTP code entered by the user
+type TOTPCodeInput struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// RecoveryCodesResponse contains freshly generated recovery codes. They are only shown once.
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+// CreateRoleInput represents the input for creating a role
+type CreateRoleInput struct {
+	Name        string   `json:"name" binding:"required,max=50"`
+	Description string   `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// UpdateRoleInput represents the input for updating a role. Omitted fields are left unchanged.
+type UpdateRoleInput struct {
+	Name        string   `json:"name" binding:"omitempty,max=50"`
+	Description *string  `json:"description"`
+	Permissions []string `json:"permissions"`
+}
+
+// CreatePersonalAccessTokenInput represents the input for creating a personal access token
+type CreatePersonalAccessTokenInput struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"omitempty,min=1,max=365"`
+}
+
+// SessionResponse describes an active session of the current user
+type SessionResponse struct {
+	ID         uint      `json:"id"`
+	Device     string    `json:"device"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	CreatedAt  time.Time `json:"created_at"`
+	Current    bool      `json:"current"`
+}
+
+// PersonalAccessTokenResponse describes a personal access token without its secret
+type PersonalAccessTokenResponse struct {
+	ID         uint       `json:"id"`
+	Name       string     `json:"name"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// PersonalAccessTokenCreatedResponse contains a new personal access token. The token is only shown once.
+type PersonalAccessTokenCreatedResponse struct {
+	Token string                      `json:"token"`
+	Info  PersonalAccessTokenResponse `json:"info"`
+}
+
+// RefreshTokenInput represents the input for refreshing or revoking a refresh token
+type RefreshTokenInput struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
 }
 
 // RegisterInput represents the input for user registration
 type RegisterInput struct {
 	Username string `json:"username" binding:"required"`
 	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required,min=6"`
+	Password string `json:"password" binding:"required"`
+}
+
+// CreateInvitationInput represents the input for inviting a user as an admin
+type CreateInvitationInput struct {
+	Email  string `json:"email" binding:"required,email"`
+	RoleID uint   `json:"role_id"`
+}
+
+// CreateProjectInvitationInput represents the input for inviting a new user to a project
+type CreateProjectInvitationInput struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// AcceptInvitationInput represents the input for creating an account from an invitation
+type AcceptInvitationInput struct {
+	Token    string `json:"token" binding:"required"`
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
 }
 
 // LoginInput represents the input for user login
@@ -112,21 +443,41 @@ type LoginInput struct {
 	Password string `json:"password" binding:"required"`
 }
 
-// UpdateProfileInput represents the input for updating user profile
+// ForgotPasswordInput represents the input for requesting a password reset
+type ForgotPasswordInput struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordInput represents the input for resetting a password with a reset token
+type ResetPasswordInput struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+// VerifyEmailInput represents the input for verifying an email address
+type VerifyEmailInput struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// UpdateProfileInput represents the input for updating user profile.
+// CurrentPassword is required when changing the password or email.
 type UpdateProfileInput struct {
-	Username string `json:"username"`
-	Email    string `json:"email" binding:"email"`
-	Password string `json:"password" binding:"min=6"`
+	Username        string `json:"username"`
+	Email           string `json:"email" binding:"omitempty,email"`
+	Password        string `json:"password"`
+	CurrentPassword string `json:"current_password"`
 }
 
 // UpdateTaskInput represents the input for updating a task
 type UpdateTaskInput struct {
-	Title       string `json:"title"`
-	Description string `json:"description"`
-	Priority    string `json:"priority" binding:"oneof=high medium normal low"`
-	Status      string `json:"status" binding:"oneof=todo in_progress completed"`
-	DueDate     string `json:"due_date" binding:"required"`
-	AssignedTo  []uint `json:"assigned_to"`
+	Title               string `json:"title"`
+	Description         string `json:"description"`
+	Priority            string `json:"priority" binding:"omitempty,oneof=high medium normal low"`
+	Status              string `json:"status" binding:"omitempty,oneof=todo in_progress completed"`
+	DueDate             string `json:"due_date"`
+	AssignedTo          []uint `json:"assigned_to"`
+	DisableStatusRollup *bool  `json:"disable_status_rollup"`
+	ProjectID           *uint  `json:"project_id"`
 }
 
 // UpdateUserStatusRequest represents the input for updating user status
@@ -134,27 +485,188 @@ type UpdateUserStatusRequest struct {
 	IsActive bool `json:"is_active" binding:"required"`
 }
 
+// UpdateUserRoleRequest represents the input for changing a user's role
+type UpdateUserRoleRequest struct {
+	RoleID uint `json:"role_id" binding:"required"`
+}
+
 // CreateTaskInput represents the input for creating a new task
 type CreateTaskInput struct {
+	Title               string `json:"title" binding:"required"`
+	Description         string `json:"description"`
+	Priority            string `json:"priority" binding:"oneof=high medium normal low"`
+	Status              string `json:"status" binding:"oneof=todo in_progress completed"`
+	DueDate             string `json:"due_date" binding:"required"`
+	AssignedTo          []uint `json:"assigned_to"`
+	DisableStatusRollup bool   `json:"disable_status_rollup"`
+	ProjectID           *uint  `json:"project_id"`
+}
+
+// TaskListQuery represents the query parameters for listing tasks
+type TaskListQuery struct {
+	ProjectID  uint   `form:"project_id"`
+	Status     string `form:"status" binding:"omitempty,oneof=todo in_progress completed"`
+	Priority   string `form:"priority" binding:"omitempty,oneof=high medium normal low"`
+	AssigneeID uint   `form:"assignee_id"`
+	CreatorID  uint   `form:"creator_id"`
+	DueFrom    string `form:"due_from"`
+	DueTo      string `form:"due_to"`
+	Search     string `form:"q"`
+	Sort       string `form:"sort" binding:"omitempty,oneof=due_date priority updated_at created_at"`
+	Order      string `form:"order" binding:"omitempty,oneof=asc desc"`
+}
+
+// AuditLogQuery represents the query parameters for listing audit log entries
+type AuditLogQuery struct {
+	ActorID        uint   `form:"actor_id"`
+	ImpersonatorID uint   `form:"impersonator_id"`
+	Action         string `form:"action"`
+	TargetType     string `form:"target_type"`
+	TargetID       uint   `form:"target_id"`
+	From           string `form:"from"`
+	To             string `form:"to"`
+	Format         string `form:"format" binding:"omitempty,oneof=json csv"`
+}
+
+// SecurityEventListResponse represents a paginated list of the user's security events
+type SecurityEventListResponse struct {
+	Data []AuditLog     `json:"data"`
+	Meta PaginationMeta `json:"meta"`
+}
+
+// AuditLogListResponse represents a paginated list of audit log entries
+type AuditLogListResponse struct {
+	Data []AuditLog     `json:"data"`
+	Meta PaginationMeta `json:"meta"`
+}
+
+// TaskListResponse represents a paginated list of tasks
+type TaskListResponse struct {
+	Data []Task         `json:"data"`
+	Meta PaginationMeta `json:"meta"`
+}
+
+// CreateSubTaskInput represents the input for creating a sub-task
+type CreateSubTaskInput struct {
 	Title       string `json:"title" binding:"required"`
 	Description string `json:"description"`
 	Priority    string `json:"priority" binding:"oneof=high medium normal low"`
 	Status      string `json:"status" binding:"oneof=todo in_progress completed"`
 	DueDate     string `json:"due_date" binding:"required"`
-	AssignedTo  []uint `json:"assigned_to"`
+}
+
+// UpdateSubTaskInput represents the input for updating a sub-task
+type UpdateSubTaskInput struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Priority    string `json:"priority" binding:"omitempty,oneof=high medium normal low"`
+	Status      string `json:"status" binding:"omitempty,oneof=todo in_progress completed"`
+	DueDate     string `json:"due_date"`
+}
+
+// ReorderSubTasksInput represents the new order of a task's sub-tasks
+type ReorderSubTasksInput struct {
+	SubTaskIDs []uint `json:"sub_task_ids" binding:"required"`
 }
 
 // DashboardResponse represents the response structure for dashboard data
 type DashboardResponse struct {
-	Todo       int `json:"todo"`
-	InProgress int `json:"in_progress"`
-	Completed  int `json:"completed"`
+	Todo       int64 `json:"todo"`
+	InProgress int64 `json:"in_progress"`
+	Completed  int64 `json:"completed"`
+}
+
+// CreateCommentInput represents the input for creating a comment
+type CreateCommentInput struct {
+	Content string `json:"content" binding:"required"`
+}
+
+// UpdateAssetInput represents the input for renaming an asset or changing its description
+type UpdateAssetInput struct {
+	OriginalFilename string  `json:"original_filename" binding:"omitempty,max=255"`
+	Description      *string `json:"description" binding:"omitempty,max=1000"`
+}
+
+// UpdateCommentInput represents the input for editing a comment
+type UpdateCommentInput struct {
+	Content string `json:"content" binding:"required"`
+}
+
+// PaginationMeta represents pagination information for list responses
+type PaginationMeta struct {
+	Page       int   `json:"page"`
+	PageSize   int   `json:"page_size"`
+	Total      int64 `json:"total"`
+	TotalPages int   `json:"total_pages"`
+}
+
+// CommentListResponse represents a paginated list of comments
+type CommentListResponse struct {
+	Data []Comment      `json:"data"`
+	Meta PaginationMeta `json:"meta"`
+}
+
+// CreateProjectInput represents the input for creating a project
+type CreateProjectInput struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+	MemberIDs   []uint `json:"member_ids"`
+}
+
+// UpdateProjectInput represents the input for updating a project
+type UpdateProjectInput struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	IsArchived  *bool  `json:"is_archived"`
+}
+
+// AddProjectMemberInput represents the input for adding a member to a project
+type AddProjectMemberInput struct {
+	UserID uint `json:"user_id" binding:"required"`
+}
+
+// ProjectListResponse represents a paginated list of projects
+type ProjectListResponse struct {
+	Data []Project      `json:"data"`
+	Meta PaginationMeta `json:"meta"`
 }
 
 // AssetResponse represents the response structure for assets
 type AssetResponse struct {
-	ID       uint   `json:"id"`
-	FilePath string `json:"file_path"`
+	ID               uint      `json:"id"`
+	TaskID           uint      `json:"task_id"`
+	StorageKey       string    `json:"storage_key"`
+	OriginalFilename string    `json:"original_filename"`
+	Size             int64     `json:"size"`
+	MimeType         string    `json:"mime_type"`
+	Checksum         string    `json:"checksum"`
+	Description      string    `json:"description"`
+	Uploader         User      `json:"uploader"`
+	UploadedAt       time.Time `json:"uploaded_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+	// URL is a short-lived direct download link, only set when the storage backend supports it
+	URL string `json:"url,omitempty"`
+}
+
+// StorageUsage represents the asset storage used by one project or uploader.
+// ID is 0 for assets of tasks without a project.
+type StorageUsage struct {
+	ID         uint   `json:"id"`
+	Name       string `json:"name"`
+	AssetCount int64  `json:"asset_count"`
+	Bytes      int64  `json:"bytes"`
+}
+
+// StorageReport represents the storage used by assets. LogicalBytes counts every asset as its own
+// copy, StoredBytes is what the storage backend actually holds after deduplication.
+type StorageReport struct {
+	AssetCount   int64          `json:"asset_count"`
+	BlobCount    int64          `json:"blob_count"`
+	LogicalBytes int64          `json:"logical_bytes"`
+	StoredBytes  int64          `json:"stored_bytes"`
+	SavedBytes   int64          `json:"saved_bytes"`
+	ByProject    []StorageUsage `json:"by_project"`
+	ByUploader   []StorageUsage `json:"by_uploader"`
 }
 
 // TaskResponse represents the response structure for a task
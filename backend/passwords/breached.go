@@ -0,0 +1,140 @@
+package passwords
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// IsBreached reports whether the password is in the local breached password list at path.
+// The list uses the SHA-1 format of Have I Been Pwned and can be either
+//
+//   - a directory of k-anonymity range files named after the first 5 hex characters of the hash
+//     (optionally with a .txt extension), each line holding the remaining 35 characters and a count
+//     ("0018A45C4D1DEF81644B54AB7F969B88D65:10"), or
+//   - a single file with one full hash per line ("HASH:COUNT"), sorted by hash, which is binary searched.
+//
+// Lookups never leave the machine. Read errors are logged and the password is treated as not
+// breached so a missing list doesn't stop users from changing their password.
+func IsBreached(path, password string) bool {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	breached, err := lookupBreached(path, hash)
+	if err != nil {
+		log.Printf("failed to check breached password list %s: %v", path, err)
+		return false
+	}
+	return breached
+}
+
+func lookupBreached(path, hash string) (bool, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+
+	if info.IsDir() {
+		return lookupRangeFile(path, hash)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	return searchSortedFile(f, info.Size(), hash)
+}
+
+// lookupRangeFile scans the range file for the hash prefix for the rest of the hash
+func lookupRangeFile(dir, hash string) (bool, error) {
+	prefix, suffix := hash[:5], hash[5:]
+
+	f, err := os.Open(filepath.Join(dir, prefix))
+	if errors.Is(err, os.ErrNotExist) {
+		f, err = os.Open(filepath.Join(dir, prefix+".txt"))
+	}
+	if errors.Is(err, os.ErrNotExist) {
+		// No file means no breached password shares the prefix
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if matchesHash(scanner.Text(), suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+// searchSortedFile binary searches a file of sorted "HASH:COUNT" lines without loading it.
+// lo always points at the start of a line and the hash, if present, starts in [lo, hi).
+func searchSortedFile(f io.ReaderAt, size int64, hash string) (bool, error) {
+	lo, hi := int64(0), size
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+
+		start, line, err := lineAfter(f, size, mid)
+		if err != nil {
+			return false, err
+		}
+		if start >= hi {
+			hi = mid
+			continue
+		}
+
+		key, _, _ := strings.Cut(strings.TrimSpace(line), ":")
+		switch strings.Compare(strings.ToUpper(key), hash) {
+		case 0:
+			return true, nil
+		case -1:
+			lo = start + int64(len(line))
+		default:
+			hi = start
+		}
+	}
+	return false, nil
+}
+
+// lineAfter returns the first line starting at or after offset, including its line break
+func lineAfter(f io.ReaderAt, size, offset int64) (int64, string, error) {
+	start := offset
+	if offset > 0 {
+		// Find the end of the line containing offset-1
+		r := bufio.NewReader(io.NewSectionReader(f, offset-1, size-offset+1))
+		skipped, err := r.ReadString('\n')
+		if err == io.EOF {
+			return size, "", nil
+		}
+		if err != nil {
+			return 0, "", err
+		}
+		start = offset - 1 + int64(len(skipped))
+	}
+
+	r := bufio.NewReader(io.NewSectionReader(f, start, size-start))
+	line, err := r.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return 0, "", err
+	}
+	return start, line, nil
+}
+
+// matchesHash compares the hash part of a "HASH:COUNT" line, ignoring entries with a zero count
+// which the range API uses as padding
+func matchesHash(line, hash string) bool {
+	key, count, _ := strings.Cut(strings.TrimSpace(line), ":")
+	return strings.EqualFold(key, hash) && count != "0"
+}
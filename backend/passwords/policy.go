@@ -0,0 +1,125 @@
+package passwords
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// bcrypt ignores everything after 72 bytes, longer passwords would only look stronger than they are
+const maxLength = 72
+
+// Policy describes the rules a new password has to follow
+type Policy struct {
+	MinLength        int
+	RequireUpper     bool
+	RequireLower     bool
+	RequireDigit     bool
+	RequireSymbol    bool
+	AllowUserInfo    bool
+	BreachedListPath string
+}
+
+// PolicyError lists every rule a password breaks
+type PolicyError struct {
+	Problems []string
+}
+
+func (e *PolicyError) Error() string {
+	return "Password " + strings.Join(e.Problems, ", ")
+}
+
+// PolicyFromEnv builds the policy from PASSWORD_MIN_LENGTH (default 8), PASSWORD_REQUIRE_UPPERCASE,
+// PASSWORD_REQUIRE_LOWERCASE, PASSWORD_REQUIRE_DIGIT, PASSWORD_REQUIRE_SYMBOL, PASSWORD_ALLOW_USER_INFO
+// (all "true" or "false", default false) and PASSWORD_BREACHED_LIST, the path of a breached password
+// list described at IsBreached.
+func PolicyFromEnv() Policy {
+	minLength, err := strconv.Atoi(os.Getenv("PASSWORD_MIN_LENGTH"))
+	if err != nil || minLength <= 0 {
+		minLength = 8
+	}
+
+	return Policy{
+		MinLength:        minLength,
+		RequireUpper:     os.Getenv("PASSWORD_REQUIRE_UPPERCASE") == "true",
+		RequireLower:     os.Getenv("PASSWORD_REQUIRE_LOWERCASE") == "true",
+		RequireDigit:     os.Getenv("PASSWORD_REQUIRE_DIGIT") == "true",
+		RequireSymbol:    os.Getenv("PASSWORD_REQUIRE_SYMBOL") == "true",
+		AllowUserInfo:    os.Getenv("PASSWORD_ALLOW_USER_INFO") == "true",
+		BreachedListPath: os.Getenv("PASSWORD_BREACHED_LIST"),
+	}
+}
+
+// Validate checks a new password against the policy configured in the environment
+func Validate(password, username, email string) error {
+	return PolicyFromEnv().Validate(password, username, email)
+}
+
+// Validate checks a new password for the user with the given username and email.
+// It returns a *PolicyError describing every broken rule, or nil.
+func (p Policy) Validate(password, username, email string) error {
+	var problems []string
+
+	if length := len([]rune(password)); length < p.MinLength {
+		problems = append(problems, "must be at least "+strconv.Itoa(p.MinLength)+" characters long")
+	}
+	if len(password) > maxLength {
+		problems = append(problems, "must be at most "+strconv.Itoa(maxLength)+" bytes long")
+	}
+
+	var upper, lower, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case !unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+	if p.RequireUpper && !upper {
+		problems = append(problems, "must contain an uppercase letter")
+	}
+	if p.RequireLower && !lower {
+		problems = append(problems, "must contain a lowercase letter")
+	}
+	if p.RequireDigit && !digit {
+		problems = append(problems, "must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		problems = append(problems, "must contain a symbol")
+	}
+
+	if !p.AllowUserInfo && containsUserInfo(password, username, email) {
+		problems = append(problems, "must not contain your username or email")
+	}
+
+	// Only look the password up once it passes everything else, the list can be large
+	if len(problems) == 0 && p.BreachedListPath != "" && IsBreached(p.BreachedListPath, password) {
+		problems = append(problems, "has appeared in a data breach, please choose another one")
+	}
+
+	if len(problems) > 0 {
+		return &PolicyError{Problems: problems}
+	}
+	return nil
+}
+
+// containsUserInfo reports whether the password contains the username, the email or its local part.
+// Very short values are ignored, they would reject too many unrelated passwords.
+func containsUserInfo(password, username, email string) bool {
+	password = strings.ToLower(password)
+	localPart, _, _ := strings.Cut(email, "@")
+
+	for _, value := range []string{username, email, localPart} {
+		value = strings.ToLower(strings.TrimSpace(value))
+		if len(value) >= 3 && strings.Contains(password, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package policies
+
+import "github.com/mfuadfakhruzzaki/project/backend/models"
+
+// Permission is a capability granted to every user of a role
+type Permission string
+
+const (
+	PermUsersManage       Permission = "users.manage"
+	PermRolesManage       Permission = "roles.manage"
+	PermTasksReadAny      Permission = "tasks.read.any"
+	PermTasksUpdateAny    Permission = "tasks.update.any"
+	PermTasksDeleteAny    Permission = "tasks.delete.any"
+	PermProjectsManageAny Permission = "projects.manage.any"
+	PermCommentsModerate  Permission = "comments.moderate"
+	PermAuditRead         Permission = "audit.read"
+	PermUsersImpersonate  Permission = "users.impersonate"
+	PermStorageRead       Permission = "storage.read"
+)
+
+// Permissions lists every built-in permission with a short description
+var Permissions = []struct {
+	Name        Permission
+	Description string
+}{
+	{PermUsersManage, "List, deactivate and delete users"},
+	{PermRolesManage, "Create and edit roles and their permissions"},
+	{PermTasksReadAny, "Read any task, including its comments, sub-tasks and assets"},
+	{PermTasksUpdateAny, "Edit any task"},
+	{PermTasksDeleteAny, "Delete any task"},
+	{PermProjectsManageAny, "Edit, archive and delete any project"},
+	{PermCommentsModerate, "Edit and delete other users' comments"},
+	{PermAuditRead, "Read and export the audit log"},
+	{PermUsersImpersonate, "Sign in as another user to see what they see"},
+	{PermStorageRead, "View storage usage of uploaded assets"},
+}
+
+const (
+	// DefaultRoleName is the role given to newly registered users
+	DefaultRoleName = "user"
+	// AdminRoleName is the role that always holds every permission
+	AdminRoleName = "admin"
+)
+
+// HasPermission reports whether the user's role grants the permission.
+// The user must be loaded with Role.Permissions.
+func HasPermission(user models.User, permission Permission) bool {
+	for _, p := range user.Role.Permissions {
+		if p.Name == string(permission) {
+			return true
+		}
+	}
+	return false
+}
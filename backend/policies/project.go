@@ -0,0 +1,69 @@
+package policies
+
+import (
+	"errors"
+
+	"github.com/mfuadfakhruzzaki/project/backend/models"
+	"gorm.io/gorm"
+)
+
+// ProjectAction is an operation a user wants to perform on a project
+type ProjectAction string
+
+const (
+	// ProjectRead covers viewing a project and adding tasks to it
+	ProjectRead ProjectAction = "read"
+	// ProjectManage covers editing, archiving and deleting a project and managing its members
+	ProjectManage ProjectAction = "manage"
+)
+
+var (
+	// ErrProjectHidden means the user may not know the project exists
+	ErrProjectHidden = errors.New("project not found")
+	// ErrProjectForbidden means the user can see the project but not perform the action
+	ErrProjectForbidden = errors.New("project action forbidden")
+)
+
+// IsProjectMember reports whether the user owns or is a member of the project
+func IsProjectMember(db *gorm.DB, userID uint, project models.Project) (bool, error) {
+	if project.OwnerID == userID {
+		return true, nil
+	}
+
+	var count int64
+	if err := db.Model(&models.ProjectMember{}).
+		Where("project_id = ? AND user_id = ?", project.ID, userID).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// AuthorizeProject checks whether the user may perform the action on the project.
+// Members may read, only the owner and users with projects.manage.any may manage.
+func AuthorizeProject(db *gorm.DB, user models.User, project models.Project, action ProjectAction) error {
+	if project.OwnerID == user.ID || HasPermission(user, PermProjectsManageAny) {
+		return nil
+	}
+
+	member, err := IsProjectMember(db, user.ID, project)
+	if err != nil {
+		return err
+	}
+	if !member {
+		return ErrProjectHidden
+	}
+	if action != ProjectRead {
+		return ErrProjectForbidden
+	}
+
+	return nil
+}
+
+// VisibleProjects limits a project query to projects the user owns or is a member of
+func VisibleProjects(user models.User) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("owner_id = ? OR id IN (SELECT project_id FROM project_members WHERE user_id = ?)", user.ID, user.ID)
+	}
+}
@@ -0,0 +1,47 @@
+package policies
+
+// Scope limits what a personal access token may do
+type Scope string
+
+const (
+	ScopeTasksRead     Scope = "tasks:read"
+	ScopeTasksWrite    Scope = "tasks:write"
+	ScopeProjectsRead  Scope = "projects:read"
+	ScopeProjectsWrite Scope = "projects:write"
+	ScopeAssetsRead    Scope = "assets:read"
+	ScopeAssetsWrite   Scope = "assets:write"
+	ScopeProfileRead   Scope = "profile:read"
+	ScopeAdmin         Scope = "admin"
+)
+
+// Scopes lists every scope a personal access token can be granted
+var Scopes = []Scope{
+	ScopeTasksRead,
+	ScopeTasksWrite,
+	ScopeProjectsRead,
+	ScopeProjectsWrite,
+	ScopeAssetsRead,
+	ScopeAssetsWrite,
+	ScopeProfileRead,
+	ScopeAdmin,
+}
+
+// IsValidScope reports whether the scope is known
+func IsValidScope(scope string) bool {
+	for _, s := range Scopes {
+		if string(s) == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HasScope reports whether the granted scopes include the required one
+func HasScope(granted []string, required Scope) bool {
+	for _, s := range granted {
+		if s == string(required) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,136 @@
+package policies
+
+import (
+	"errors"
+
+	"github.com/mfuadfakhruzzaki/project/backend/models"
+	"gorm.io/gorm"
+)
+
+// TaskAction is an operation a user wants to perform on a task
+type TaskAction string
+
+const (
+	// TaskRead covers viewing a task and its comments, sub-tasks and assets
+	TaskRead TaskAction = "read"
+	// TaskUpdate covers editing a task and managing its sub-tasks and assets
+	TaskUpdate TaskAction = "update"
+	// TaskDelete covers deleting a task
+	TaskDelete TaskAction = "delete"
+)
+
+// TaskRelation describes how a user is related to a task
+type TaskRelation string
+
+const (
+	RelationCreator       TaskRelation = "creator"
+	RelationAssignee      TaskRelation = "assignee"
+	RelationProjectOwner  TaskRelation = "project_owner"
+	RelationProjectMember TaskRelation = "project_member"
+)
+
+// taskRules lists which relations may perform each action. New relations
+// (e.g. watchers) only need a resolver in TaskRelations and an entry here.
+var taskRules = map[TaskAction][]TaskRelation{
+	TaskRead:   {RelationCreator, RelationAssignee, RelationProjectOwner, RelationProjectMember},
+	TaskUpdate: {RelationCreator, RelationAssignee, RelationProjectOwner, RelationProjectMember},
+	TaskDelete: {RelationCreator, RelationProjectOwner},
+}
+
+// taskPermissions lists the permission that allows each action on any task regardless of relations
+var taskPermissions = map[TaskAction]Permission{
+	TaskRead:   PermTasksReadAny,
+	TaskUpdate: PermTasksUpdateAny,
+	TaskDelete: PermTasksDeleteAny,
+}
+
+var (
+	// ErrTaskHidden means the user may not know the task exists
+	ErrTaskHidden = errors.New("task not found")
+	// ErrTaskForbidden means the user can see the task but not perform the action
+	ErrTaskForbidden = errors.New("task action forbidden")
+)
+
+// TaskRelations returns every relation the user has to the task
+func TaskRelations(db *gorm.DB, user models.User, task models.Task) ([]TaskRelation, error) {
+	var relations []TaskRelation
+
+	if task.CreatedBy == user.ID {
+		relations = append(relations, RelationCreator)
+	}
+
+	var assignments int64
+	if err := db.Model(&models.TaskAssignment{}).
+		Where("task_id = ? AND user_id = ?", task.ID, user.ID).
+		Count(&assignments).Error; err != nil {
+		return nil, err
+	}
+	if assignments > 0 {
+		relations = append(relations, RelationAssignee)
+	}
+
+	if task.ProjectID != nil {
+		var project models.Project
+		if err := db.First(&project, *task.ProjectID).Error; err != nil {
+			return nil, err
+		}
+
+		if project.OwnerID == user.ID {
+			relations = append(relations, RelationProjectOwner)
+		} else {
+			member, err := IsProjectMember(db, user.ID, project)
+			if err != nil {
+				return nil, err
+			}
+			if member {
+				relations = append(relations, RelationProjectMember)
+			}
+		}
+	}
+
+	return relations, nil
+}
+
+// VisibleTasks limits a task query to tasks the user created, is assigned to
+// or can see through one of their projects
+func VisibleTasks(user models.User) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(
+			"created_by = ? OR id IN (SELECT task_id FROM task_assignments WHERE user_id = ?) "+
+				"OR project_id IN (SELECT id FROM projects WHERE owner_id = ?) "+
+				"OR project_id IN (SELECT project_id FROM project_members WHERE user_id = ?)",
+			user.ID, user.ID, user.ID, user.ID,
+		)
+	}
+}
+
+// AuthorizeTask checks whether the user may perform the action on the task.
+// It returns ErrTaskHidden when the user cannot even read the task, so callers
+// can answer 404 without leaking its existence, and ErrTaskForbidden otherwise.
+func AuthorizeTask(db *gorm.DB, user models.User, task models.Task, action TaskAction) error {
+	relations, err := TaskRelations(db, user, task)
+	if err != nil {
+		return err
+	}
+
+	if !allows(relations, TaskRead) && !HasPermission(user, taskPermissions[TaskRead]) {
+		return ErrTaskHidden
+	}
+	if !allows(relations, action) && !HasPermission(user, taskPermissions[action]) {
+		return ErrTaskForbidden
+	}
+
+	return nil
+}
+
+// allows reports whether any of the relations grants the action
+func allows(relations []TaskRelation, action TaskAction) bool {
+	for _, allowed := range taskRules[action] {
+		for _, relation := range relations {
+			if relation == allowed {
+				return true
+			}
+		}
+	}
+	return false
+}
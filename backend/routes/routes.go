@@ -4,7 +4,11 @@ package routes
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/mfuadfakhruzzaki/project/backend/controllers"
-	controllers "github.com/mfuadfakhruzzaki/project/backend/middlewares"
+	"github.com/mfuadfakhruzzaki/project/backend/mailer"
+	"github.com/mfuadfakhruzzaki/project/backend/middlewares"
+	"github.com/mfuadfakhruzzaki/project/backend/policies"
+	"github.com/mfuadfakhruzzaki/project/backend/sso"
+	"github.com/mfuadfakhruzzaki/project/backend/storage"
 	"gorm.io/gorm"
 
 	swaggerFiles "github.com/swaggo/files"
@@ -12,44 +16,135 @@ import (
 )
 
 // SetupRoutes mengatur semua rute aplikasi
-func SetupRoutes(router *gin.Engine, db *gorm.DB) {
+func SetupRoutes(router *gin.Engine, db *gorm.DB, m mailer.Mailer, idp *sso.Provider, store storage.Storage) {
 	// Public routes
-	router.POST("/register", controllers.Register(db))
+	router.POST("/register", controllers.Register(db, m))
 	router.POST("/login", controllers.Login(db))
+	router.POST("/login/2fa", controllers.LoginTwoFactor(db))
+	router.POST("/logout", controllers.Logout(db))
+	router.POST("/token/refresh", controllers.RefreshToken(db))
+	router.POST("/password/forgot", controllers.ForgotPassword(db, m))
+	router.POST("/password/reset", controllers.ResetPassword(db))
+	router.POST("/email/verify", controllers.VerifyEmail(db))
+	router.POST("/invitations/accept", controllers.AcceptInvitation(db))
+
+	// Single sign-on, only when an identity provider is configured
+	if idp != nil {
+		router.GET("/oidc/login", controllers.OIDCLogin(db, idp))
+		router.GET("/oidc/callback", controllers.OIDCCallback(db, idp))
+	}
 
 	// Swagger UI
 	router.GET("/swagger/*any", ginSwagger.WrapHandler(swaggerFiles.Handler))
 
+	// Public keys for services verifying our tokens
+	router.GET("/.well-known/jwks.json", controllers.GetJWKS())
+
 	// Protected routes
 	api := router.Group("/api")
 	api.Use(middlewares.AuthMiddleware(db))
 	{
-		// Admin - User Management
+		// Admin
 		admin := api.Group("/admin")
-		admin.Use(middlewares.AdminMiddleware())
+		admin.Use(middlewares.RequireScope(policies.ScopeAdmin))
 		{
-			admin.GET("/users", controllers.GetAllUsers(db))
-			admin.DELETE("/users/:id", controllers.DeleteUser(db))
-			admin.PUT("/users/:id/status", controllers.UpdateUserStatus(db))
+			// User Management
+			manageUsers := middlewares.RequirePermission(policies.PermUsersManage)
+			admin.GET("/users", manageUsers, controllers.GetAllUsers(db))
+			admin.DELETE("/users/:id", manageUsers, controllers.DeleteUser(db))
+			admin.PUT("/users/:id/status", manageUsers, controllers.UpdateUserStatus(db))
+			admin.PUT("/users/:id/role", manageUsers, controllers.UpdateUserRole(db))
+			admin.DELETE("/users/:id/2fa", manageUsers, controllers.ResetUserTwoFactor(db))
+			admin.DELETE("/users/:id/lockout", manageUsers, controllers.UnlockUser(db))
+			admin.GET("/invitations", manageUsers, controllers.GetInvitations(db))
+			admin.POST("/invitations", manageUsers, controllers.CreateInvitation(db, m))
+			admin.DELETE("/invitations/:id", manageUsers, controllers.RevokeInvitation(db))
+			admin.POST("/users/:id/impersonate", middlewares.RequirePermission(policies.PermUsersImpersonate), middlewares.RequireSession(), controllers.ImpersonateUser(db))
+
+			// Role Management
+			manageRoles := middlewares.RequirePermission(policies.PermRolesManage)
+			admin.GET("/permissions", manageRoles, controllers.GetPermissions(db))
+			admin.GET("/roles", manageRoles, controllers.GetRoles(db))
+			admin.POST("/roles", manageRoles, controllers.CreateRole(db))
+			admin.PUT("/roles/:id", manageRoles, controllers.UpdateRole(db))
+			admin.DELETE("/roles/:id", manageRoles, controllers.DeleteRole(db))
+
+			// Audit Log
+			admin.GET("/audit-logs", middlewares.RequirePermission(policies.PermAuditRead), controllers.GetAuditLogs(db))
+
+			// Storage
+			admin.GET("/storage", middlewares.RequirePermission(policies.PermStorageRead), controllers.GetStorageReport(db))
 		}
 
 		// Tasks
 		tasks := api.Group("/tasks")
 		{
-			tasks.GET("", controllers.GetTasks(db))
-			tasks.POST("", controllers.CreateTask(db))
-			tasks.GET("/:id", controllers.GetTaskByID(db))
-			tasks.PUT("/:id", controllers.UpdateTask(db))
-			tasks.DELETE("/:id", controllers.DeleteTask(db))
+			canRead := middlewares.TaskAccessMiddleware(db, policies.TaskRead)
+			canUpdate := middlewares.TaskAccessMiddleware(db, policies.TaskUpdate)
+			canDelete := middlewares.TaskAccessMiddleware(db, policies.TaskDelete)
+			readTasks := middlewares.RequireScope(policies.ScopeTasksRead)
+			writeTasks := middlewares.RequireScope(policies.ScopeTasksWrite)
+			readAssets := middlewares.RequireScope(policies.ScopeAssetsRead)
+			writeAssets := middlewares.RequireScope(policies.ScopeAssetsWrite)
+
+			tasks.GET("", readTasks, controllers.GetTasks(db))
+			tasks.POST("", writeTasks, controllers.CreateTask(db))
+			tasks.GET("/:id", readTasks, canRead, controllers.GetTaskByID(db))
+			tasks.PUT("/:id", writeTasks, canUpdate, controllers.UpdateTask(db))
+			tasks.DELETE("/:id", writeTasks, canDelete, controllers.DeleteTask(db, store))
 
 			// Assets
-			tasks.GET("/:id/assets", controllers.GetAssets(db))
-			tasks.POST("/:id/assets", controllers.UploadAsset(db))
+			tasks.GET("/:id/assets", readAssets, canRead, controllers.GetAssets(db, store))
+			tasks.POST("/:id/assets", writeAssets, canUpdate, controllers.UploadAsset(db, store))
+			tasks.GET("/:id/assets/:assetId/download", readAssets, canRead, controllers.DownloadAsset(db, store))
+			tasks.PUT("/:id/assets/:assetId", writeAssets, canUpdate, controllers.UpdateAsset(db, store))
+			tasks.DELETE("/:id/assets/:assetId", writeAssets, canUpdate, controllers.DeleteAsset(db, store))
+
+			// Comments
+			tasks.GET("/:id/comments", readTasks, canRead, controllers.GetComments(db))
+			tasks.POST("/:id/comments", writeTasks, canRead, controllers.CreateComment(db))
+			tasks.PUT("/:id/comments/:commentId", writeTasks, canRead, controllers.UpdateComment(db))
+			tasks.DELETE("/:id/comments/:commentId", writeTasks, canRead, controllers.DeleteComment(db))
+
+			// Sub-tasks
+			tasks.GET("/:id/subtasks", readTasks, canRead, controllers.GetSubTasks(db))
+			tasks.POST("/:id/subtasks", writeTasks, canUpdate, controllers.CreateSubTask(db))
+			tasks.PUT("/:id/subtasks/reorder", writeTasks, canUpdate, controllers.ReorderSubTasks(db))
+			tasks.PUT("/:id/subtasks/:subtaskId", writeTasks, canUpdate, controllers.UpdateSubTask(db))
+			tasks.DELETE("/:id/subtasks/:subtaskId", writeTasks, canUpdate, controllers.DeleteSubTask(db))
+		}
+
+		// Projects
+		projects := api.Group("/projects")
+		{
+			canRead := middlewares.ProjectAccessMiddleware(db, policies.ProjectRead)
+			canManage := middlewares.ProjectAccessMiddleware(db, policies.ProjectManage)
+			readProjects := middlewares.RequireScope(policies.ScopeProjectsRead)
+			writeProjects := middlewares.RequireScope(policies.ScopeProjectsWrite)
+
+			projects.GET("", readProjects, controllers.GetProjects(db))
+			projects.POST("", writeProjects, controllers.CreateProject(db))
+			projects.GET("/:id", readProjects, canRead, controllers.GetProjectByID(db))
+			projects.PUT("/:id", writeProjects, canManage, controllers.UpdateProject(db))
+			projects.DELETE("/:id", writeProjects, canManage, controllers.DeleteProject(db))
+			projects.POST("/:id/members", writeProjects, canManage, controllers.AddProjectMember(db))
+			projects.DELETE("/:id/members/:userId", writeProjects, canManage, controllers.RemoveProjectMember(db))
+			projects.POST("/:id/invitations", writeProjects, canManage, controllers.CreateProjectInvitation(db, m))
 		}
 	}
 
 	// Other protected routes
-	router.GET("/profile", middlewares.AuthMiddleware(db), controllers.GetProfile(db))
-	router.PUT("/profile", middlewares.AuthMiddleware(db), controllers.UpdateProfile(db))
-	router.GET("/dashboard", middlewares.AuthMiddleware(db), controllers.GetDashboard(db))
+	// Personal access tokens can read the profile and dashboard but can't change credentials or mint more tokens
+	router.GET("/profile", middlewares.AuthMiddleware(db), middlewares.RequireScope(policies.ScopeProfileRead), controllers.GetProfile(db))
+	router.PUT("/profile", middlewares.AuthMiddleware(db), middlewares.RequireSession(), controllers.UpdateProfile(db, m))
+	router.GET("/profile/security-events", middlewares.AuthMiddleware(db), middlewares.RequireScope(policies.ScopeProfileRead), controllers.GetSecurityEvents(db))
+	router.POST("/email/verify/resend", middlewares.AuthMiddleware(db), middlewares.RequireSession(), controllers.ResendVerificationEmail(db, m))
+	router.POST("/profile/2fa/enroll", middlewares.AuthMiddleware(db), middlewares.RequireSession(), controllers.EnrollTOTP(db))
+	router.POST("/profile/2fa/confirm", middlewares.AuthMiddleware(db), middlewares.RequireSession(), controllers.ConfirmTOTP(db))
+	router.GET("/profile/tokens", middlewares.AuthMiddleware(db), middlewares.RequireSession(), controllers.GetPersonalAccessTokens(db))
+	router.POST("/profile/tokens", middlewares.AuthMiddleware(db), middlewares.RequireSession(), controllers.CreatePersonalAccessToken(db))
+	router.DELETE("/profile/tokens/:id", middlewares.AuthMiddleware(db), middlewares.RequireSession(), controllers.RevokePersonalAccessToken(db))
+	router.GET("/profile/sessions", middlewares.AuthMiddleware(db), middlewares.RequireSession(), controllers.GetSessions(db))
+	router.DELETE("/profile/sessions/:id", middlewares.AuthMiddleware(db), middlewares.RequireSession(), controllers.RevokeSession(db))
+	router.GET("/dashboard", middlewares.AuthMiddleware(db), middlewares.RequireScope(policies.ScopeTasksRead), controllers.GetDashboard(db))
 }
@@ -0,0 +1,233 @@
+package sso
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+// Identity is the user as described by the identity provider
+type Identity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+	Username      string
+	Groups        []string
+	// MFA reports whether the provider says the login used more than one factor
+	MFA bool
+}
+
+// RoleMapping assigns Role to members of Group
+type RoleMapping struct {
+	Group string
+	Role  string
+}
+
+// Provider runs the OpenID Connect authorization code flow with PKCE against a single issuer
+type Provider struct {
+	Issuer       string
+	GroupsClaim  string
+	RoleMappings []RoleMapping
+	MFAACRValues []string
+
+	config   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewFromEnv discovers the provider configured by OIDC_ISSUER_URL. It returns nil without error
+// when OIDC is not configured.
+//
+// OIDC_CLIENT_ID, OIDC_CLIENT_SECRET and OIDC_REDIRECT_URL describe this application as a client.
+// OIDC_SCOPES overrides the requested scopes (default "openid email profile"), OIDC_GROUPS_CLAIM names
+// the ID token claim holding the groups (default "groups") and OIDC_ROLE_MAPPING maps groups to roles
+// as "group=role" pairs separated by commas. The first matching pair wins. OIDC_MFA_ACR_VALUES lists the
+// acr values, separated by commas, that the provider only issues after a second factor.
+func NewFromEnv(ctx context.Context) (*Provider, error) {
+	issuer := os.Getenv("OIDC_ISSUER_URL")
+	if issuer == "" {
+		return nil, nil
+	}
+
+	clientID := os.Getenv("OIDC_CLIENT_ID")
+	redirectURL := os.Getenv("OIDC_REDIRECT_URL")
+	if clientID == "" || redirectURL == "" {
+		return nil, errors.New("OIDC_CLIENT_ID and OIDC_REDIRECT_URL are required when OIDC_ISSUER_URL is set")
+	}
+
+	mappings, err := parseRoleMappings(os.Getenv("OIDC_ROLE_MAPPING"))
+	if err != nil {
+		return nil, err
+	}
+
+	provider, err := oidc.NewProvider(ctx, issuer)
+	if err != nil {
+		return nil, fmt.Errorf("discover OIDC issuer %s: %w", issuer, err)
+	}
+
+	scopes := strings.Fields(os.Getenv("OIDC_SCOPES"))
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID, "email", "profile"}
+	}
+
+	groupsClaim := os.Getenv("OIDC_GROUPS_CLAIM")
+	if groupsClaim == "" {
+		groupsClaim = "groups"
+	}
+
+	var acrValues []string
+	for _, value := range strings.Split(os.Getenv("OIDC_MFA_ACR_VALUES"), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			acrValues = append(acrValues, value)
+		}
+	}
+
+	return &Provider{
+		Issuer:       issuer,
+		GroupsClaim:  groupsClaim,
+		RoleMappings: mappings,
+		MFAACRValues: acrValues,
+		config: oauth2.Config{
+			ClientID:     clientID,
+			ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+			RedirectURL:  redirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       scopes,
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: clientID}),
+	}, nil
+}
+
+func parseRoleMappings(value string) ([]RoleMapping, error) {
+	var mappings []RoleMapping
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		group, role, ok := strings.Cut(pair, "=")
+		group, role = strings.TrimSpace(group), strings.TrimSpace(role)
+		if !ok || group == "" || role == "" {
+			return nil, fmt.Errorf("invalid OIDC_ROLE_MAPPING entry %q, expected group=role", pair)
+		}
+		mappings = append(mappings, RoleMapping{Group: group, Role: role})
+	}
+	return mappings, nil
+}
+
+// AuthCodeURL returns the URL of the provider's login page. The verifier is kept by the caller and
+// only its S256 challenge is sent.
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) string {
+	return p.config.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier))
+}
+
+// Exchange redeems the authorization code and returns the identity from the verified ID token
+func (p *Provider) Exchange(ctx context.Context, code, verifier, nonce string) (*Identity, error) {
+	token, err := p.config.Exchange(ctx, code, oauth2.VerifierOption(verifier))
+	if err != nil {
+		return nil, fmt.Errorf("exchange code: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("verify id_token: %w", err)
+	}
+	if idToken.Nonce != nonce {
+		return nil, errors.New("id_token nonce mismatch")
+	}
+
+	var claims map[string]interface{}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("decode id_token claims: %w", err)
+	}
+
+	identity := &Identity{
+		Issuer:   idToken.Issuer,
+		Subject:  idToken.Subject,
+		Email:    stringClaim(claims, "email"),
+		Name:     stringClaim(claims, "name"),
+		Username: stringClaim(claims, "preferred_username"),
+		Groups:   stringsClaim(claims, p.GroupsClaim),
+		MFA:      p.usedMFA(claims),
+	}
+
+	// Some providers send email_verified as a string
+	switch verified := claims["email_verified"].(type) {
+	case bool:
+		identity.EmailVerified = verified
+	case string:
+		identity.EmailVerified = verified == "true"
+	}
+
+	return identity, nil
+}
+
+// usedMFA checks the amr claim for "mfa" (RFC 8176) and the acr claim against the configured values
+func (p *Provider) usedMFA(claims map[string]interface{}) bool {
+	for _, method := range stringsClaim(claims, "amr") {
+		if method == "mfa" {
+			return true
+		}
+	}
+
+	acr := stringClaim(claims, "acr")
+	for _, value := range p.MFAACRValues {
+		if acr != "" && acr == value {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleFor returns the role mapped to the first matching group, or "" if none matches
+func (p *Provider) RoleFor(groups []string) string {
+	member := make(map[string]bool, len(groups))
+	for _, group := range groups {
+		member[group] = true
+	}
+
+	for _, mapping := range p.RoleMappings {
+		if member[mapping.Group] {
+			return mapping.Role
+		}
+	}
+	return ""
+}
+
+func stringClaim(claims map[string]interface{}, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+func stringsClaim(claims map[string]interface{}, name string) []string {
+	switch value := claims[name].(type) {
+	case []interface{}:
+		values := make([]string, 0, len(value))
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	case string:
+		return []string{value}
+	}
+	return nil
+}
+
+// GenerateVerifier returns a new PKCE code verifier
+func GenerateVerifier() string {
+	return oauth2.GenerateVerifier()
+}
@@ -0,0 +1,70 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when no object exists for a key
+	ErrNotFound = errors.New("storage: object not found")
+	// ErrSignedURLUnsupported is returned by backends that can't hand out direct download links
+	ErrSignedURLUnsupported = errors.New("storage: signed URLs are not supported by this backend")
+)
+
+// Object describes a stored file
+type Object struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// Storage keeps uploaded files under slash separated keys such as "tasks/12/report.pdf".
+// Keys are chosen by the application and never point outside the backend.
+type Storage interface {
+	// Put stores size bytes from r under key, replacing any existing object
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Get opens the object for reading, seeking allows serving byte ranges
+	Get(ctx context.Context, key string) (io.ReadSeekCloser, error)
+	// Delete removes the object, deleting a missing object is not an error
+	Delete(ctx context.Context, key string) error
+	// Stat returns the object's metadata
+	Stat(ctx context.Context, key string) (Object, error)
+	// SignedURL returns a time limited link that downloads the object without going through the API.
+	// The download is served as an attachment named filename with the given content type, since
+	// keys don't carry the original name and the stored type may differ from the asset's.
+	SignedURL(ctx context.Context, key string, expiry time.Duration, filename, contentType string) (string, error)
+}
+
+// NewFromEnv returns the storage selected by STORAGE_DRIVER ("local" or "s3", default "local").
+//
+// The local driver stores files below STORAGE_LOCAL_DIR (default "./uploads"). The s3 driver works
+// with any S3 compatible service such as MinIO and is configured with S3_ENDPOINT, S3_BUCKET,
+// S3_ACCESS_KEY, S3_SECRET_KEY, S3_REGION, S3_USE_SSL (default true) and S3_FORCE_PATH_STYLE.
+func NewFromEnv(ctx context.Context) (Storage, error) {
+	switch driver := os.Getenv("STORAGE_DRIVER"); driver {
+	case "", "local":
+		dir := os.Getenv("STORAGE_LOCAL_DIR")
+		if dir == "" {
+			dir = "./uploads"
+		}
+		return NewLocal(dir)
+	case "s3":
+		return NewS3(ctx, S3Config{
+			Endpoint:       os.Getenv("S3_ENDPOINT"),
+			Bucket:         os.Getenv("S3_BUCKET"),
+			AccessKey:      os.Getenv("S3_ACCESS_KEY"),
+			SecretKey:      os.Getenv("S3_SECRET_KEY"),
+			Region:         os.Getenv("S3_REGION"),
+			UseSSL:         os.Getenv("S3_USE_SSL") != "false",
+			ForcePathStyle: os.Getenv("S3_FORCE_PATH_STYLE") == "true",
+		})
+	default:
+		return nil, fmt.Errorf("unknown STORAGE_DRIVER %q", driver)
+	}
+}
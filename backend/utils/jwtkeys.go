@@ -0,0 +1,304 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// ErrNoJWTKeys is returned when JWT_KEYS_DIR is not set or holds no keys
+var ErrNoJWTKeys = errors.New("no JWT signing keys configured")
+
+// SigningKey is a key used to sign or verify JWTs, identified by the kid header
+type SigningKey struct {
+	ID     string
+	Method jwt.SigningMethod
+	// PrivateKey is nil for retired keys that are only kept to verify tokens issued before a rotation
+	PrivateKey crypto.PrivateKey
+	PublicKey  crypto.PublicKey
+}
+
+// KeySet holds the key used to sign new tokens and every key accepted for verification
+type KeySet struct {
+	Active *SigningKey
+	Keys   map[string]*SigningKey
+}
+
+// JWK is a public key in JSON Web Key format
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+var (
+	jwtKeysMu sync.RWMutex
+	jwtKeys   *KeySet
+)
+
+// InitJWTKeys loads the signing keys from JWT_KEYS_DIR. Every *.pem file in the directory is a key
+// whose kid is the file name without extension: PKCS#8 or PKCS#1 private keys (RSA or Ed25519) can
+// sign and verify, PUBLIC KEY files only verify. JWT_ACTIVE_KID selects the key used to sign new
+// tokens and may be omitted when there is a single private key.
+//
+// To rotate, add the new key, point JWT_ACTIVE_KID at it and keep the old key (or just its public
+// half) until the tokens it signed have expired.
+//
+// Outside release mode a temporary key is generated when nothing is configured, so tokens don't
+// survive a restart. In release mode missing keys are an error.
+func InitJWTKeys(release bool) error {
+	keys, err := LoadJWTKeys(os.Getenv("JWT_KEYS_DIR"), os.Getenv("JWT_ACTIVE_KID"))
+	if errors.Is(err, ErrNoJWTKeys) && !release {
+		log.Println("JWT_KEYS_DIR is not configured, using a temporary signing key. Tokens will not survive a restart")
+		keys, err = generateTemporaryKeySet()
+	}
+	if err != nil {
+		return err
+	}
+
+	jwtKeysMu.Lock()
+	jwtKeys = keys
+	jwtKeysMu.Unlock()
+	return nil
+}
+
+// LoadJWTKeys reads the keys in dir and selects activeKID for signing
+func LoadJWTKeys(dir, activeKID string) (*KeySet, error) {
+	if dir == "" {
+		return nil, ErrNoJWTKeys
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	keys := &KeySet{Keys: make(map[string]*SigningKey)}
+	var signers []string
+	for _, file := range files {
+		kid := strings.TrimSuffix(strings.TrimSuffix(filepath.Base(file), ".pem"), ".pub")
+
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		key, err := parseSigningKey(kid, data)
+		if err != nil {
+			return nil, fmt.Errorf("JWT key %s: %w", file, err)
+		}
+		if _, exists := keys.Keys[kid]; exists {
+			return nil, fmt.Errorf("duplicate JWT key id %q", kid)
+		}
+
+		keys.Keys[kid] = key
+		if key.PrivateKey != nil {
+			signers = append(signers, kid)
+		}
+	}
+
+	if len(keys.Keys) == 0 {
+		return nil, ErrNoJWTKeys
+	}
+
+	if activeKID == "" {
+		if len(signers) != 1 {
+			return nil, errors.New("JWT_ACTIVE_KID must be set when there isn't exactly one private key")
+		}
+		activeKID = signers[0]
+	}
+
+	active, ok := keys.Keys[activeKID]
+	if !ok || active.PrivateKey == nil {
+		return nil, fmt.Errorf("no private key found for JWT_ACTIVE_KID %q", activeKID)
+	}
+	keys.Active = active
+
+	return keys, nil
+}
+
+// parseSigningKey decodes a PEM encoded RSA or Ed25519 key
+func parseSigningKey(kid string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &SigningKey{ID: kid}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.PrivateKey, key.PublicKey = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Method, key.PublicKey = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.Method, key.PrivateKey, key.PublicKey = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.Method, key.PublicKey = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T, only RSA and Ed25519 are supported", parsed)
+	}
+
+	if rsaKey, ok := key.PublicKey.(*rsa.PublicKey); ok && rsaKey.N.BitLen() < 2048 {
+		return nil, errors.New("RSA keys must be at least 2048 bits")
+	}
+
+	return key, nil
+}
+
+// generateTemporaryKeySet creates an in-memory Ed25519 key for development
+func generateTemporaryKeySet() (*KeySet, error) {
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	kid, err := GenerateRandomToken(8)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &SigningKey{ID: kid, Method: jwt.SigningMethodEdDSA, PrivateKey: private, PublicKey: private.Public()}
+	return &KeySet{Active: key, Keys: map[string]*SigningKey{kid: key}}, nil
+}
+
+func currentJWTKeys() (*KeySet, error) {
+	jwtKeysMu.RLock()
+	defer jwtKeysMu.RUnlock()
+	if jwtKeys == nil {
+		return nil, errors.New("JWT keys are not initialized")
+	}
+	return jwtKeys, nil
+}
+
+// Token types set in the typ header. The keys are published, so services verifying tokens against
+// the JWKS rely on typ and aud to tell access tokens from other tokens this service signs.
+const (
+	tokenTypeAccess    = "at+jwt"
+	tokenTypeChallenge = "2fa-challenge+jwt"
+)
+
+// signJWT signs the claims with the active key and sets its kid and the token type in the header.
+// The iss claim is added for every token.
+func signJWT(claims jwt.MapClaims, typ string) (string, error) {
+	keys, err := currentJWTKeys()
+	if err != nil {
+		return "", err
+	}
+
+	claims["iss"] = GetJWTIssuer()
+	token := jwt.NewWithClaims(keys.Active.Method, claims)
+	token.Header["kid"] = keys.Active.ID
+	token.Header["typ"] = typ
+	return token.SignedString(keys.Active.PrivateKey)
+}
+
+// parseJWT verifies the token with the key named by its kid header and returns its claims. The token
+// must have the given type, be issued by this service and name one of the audiences.
+func parseJWT(tokenStr string, typ string, audiences ...string) (jwt.MapClaims, error) {
+	keys, err := currentJWTKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		key, ok := keys.Keys[kid]
+		if !ok {
+			return nil, errors.New("unknown key id")
+		}
+		// The algorithm must be the one the key is meant for, never what the token asks for
+		if token.Method.Alg() != key.Method.Alg() {
+			return nil, errors.New("unexpected signing method")
+		}
+		return key.PublicKey, nil
+	})
+	if err != nil || !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+	if token.Header["typ"] != typ {
+		return nil, errors.New("invalid token type")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil, errors.New("invalid token claims")
+	}
+	if !claims.VerifyIssuer(GetJWTIssuer(), true) {
+		return nil, errors.New("invalid token issuer")
+	}
+	for _, audience := range audiences {
+		if claims.VerifyAudience(audience, true) {
+			return claims, nil
+		}
+	}
+	return nil, errors.New("invalid token audience")
+}
+
+// GetJWKS returns the public keys that verify tokens issued by this service
+func GetJWKS() (JWKSet, error) {
+	keys, err := currentJWTKeys()
+	if err != nil {
+		return JWKSet{}, err
+	}
+
+	set := JWKSet{Keys: make([]JWK, 0, len(keys.Keys))}
+	for _, key := range keys.Keys {
+		jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+		switch pub := key.PublicKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	// Keep the output stable for caches
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+
+	return set, nil
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// DefaultPageSize is used when the client does not specify page_size
+	DefaultPageSize = 20
+	// MaxPageSize caps page_size to keep responses bounded
+	MaxPageSize = 100
+)
+
+// GetPagination reads page and page_size query parameters, applying defaults and limits
+func GetPagination(c *gin.Context) (page int, pageSize int) {
+	page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	pageSize, err = strconv.Atoi(c.DefaultQuery("page_size", strconv.Itoa(DefaultPageSize)))
+	if err != nil || pageSize < 1 {
+		pageSize = DefaultPageSize
+	}
+	if pageSize > MaxPageSize {
+		pageSize = MaxPageSize
+	}
+
+	return page, pageSize
+}
+
+// TotalPages calculates the number of pages needed to hold total items
+func TotalPages(total int64, pageSize int) int {
+	if pageSize <= 0 {
+		return 0
+	}
+	return int((total + int64(pageSize) - 1) / int64(pageSize))
+}
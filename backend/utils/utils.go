@@ -2,72 +2,352 @@
 package utils
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 )
 
-// GetJWTSecret retrieves the JWT secret from environment variables
-func GetJWTSecret() []byte {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		// Default secret if not set, but it's recommended to set it in .env
-		return []byte("your_jwt_secret")
+// PersonalAccessTokenPrefix marks bearer tokens that are personal access tokens rather than JWTs
+const PersonalAccessTokenPrefix = "pat_"
+
+// Registration modes
+const (
+	// RegistrationOpen lets anyone register
+	RegistrationOpen = "open"
+	// RegistrationInviteOnly only creates accounts from invitations
+	RegistrationInviteOnly = "invite_only"
+	// RegistrationDisabled creates no new accounts at all
+	RegistrationDisabled = "disabled"
+)
+
+// AccessTokenClaims holds the values carried by an access token
+type AccessTokenClaims struct {
+	UserID       uint
+	TokenVersion uint
+	SessionID    uint
+	// ImpersonatorID is the admin acting as the user, 0 for regular tokens
+	ImpersonatorID uint
+}
+
+// GetAccessTokenTTL returns how long access tokens are valid, configured through ACCESS_TOKEN_TTL
+func GetAccessTokenTTL() time.Duration {
+	return getDurationEnv("ACCESS_TOKEN_TTL", 15*time.Minute)
+}
+
+// GetRefreshTokenTTL returns how long refresh tokens are valid, configured through REFRESH_TOKEN_TTL
+func GetRefreshTokenTTL() time.Duration {
+	return getDurationEnv("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+}
+
+// GetRegistrationMode returns how new accounts can be created, configured through REGISTRATION_MODE
+// ("open", "invite_only" or "disabled", default "open"). Unknown values disable registration.
+func GetRegistrationMode() string {
+	switch mode := strings.ReplaceAll(os.Getenv("REGISTRATION_MODE"), "-", "_"); mode {
+	case "":
+		return RegistrationOpen
+	case RegistrationOpen, RegistrationInviteOnly, RegistrationDisabled:
+		return mode
+	default:
+		return RegistrationDisabled
+	}
+}
+
+// GetInvitationTTL returns how long invitations can be accepted, configured through INVITATION_TTL
+func GetInvitationTTL() time.Duration {
+	return getDurationEnv("INVITATION_TTL", 7*24*time.Hour)
+}
+
+// GetImpersonationTokenTTL returns how long impersonation tokens are valid, configured through IMPERSONATION_TOKEN_TTL
+func GetImpersonationTokenTTL() time.Duration {
+	return getDurationEnv("IMPERSONATION_TOKEN_TTL", 15*time.Minute)
+}
+
+// ImpersonationAllowsWrites reports whether impersonation tokens may create and update data.
+// They are read-only unless IMPERSONATION_ALLOW_WRITES=true, deletes are never allowed.
+func ImpersonationAllowsWrites() bool {
+	return os.Getenv("IMPERSONATION_ALLOW_WRITES") == "true"
+}
+
+// GetSignedURLTTL returns how long direct download links to stored assets are valid, configured through STORAGE_SIGNED_URL_TTL
+func GetSignedURLTTL() time.Duration {
+	return getDurationEnv("STORAGE_SIGNED_URL_TTL", 15*time.Minute)
+}
+
+// GetPasswordResetTokenTTL returns how long password reset tokens are valid, configured through PASSWORD_RESET_TOKEN_TTL
+func GetPasswordResetTokenTTL() time.Duration {
+	return getDurationEnv("PASSWORD_RESET_TOKEN_TTL", time.Hour)
+}
+
+// GetPasswordResetResendInterval returns the minimum time between two password reset emails to the
+// same account, configured through PASSWORD_RESET_RESEND_INTERVAL
+func GetPasswordResetResendInterval() time.Duration {
+	return getDurationEnv("PASSWORD_RESET_RESEND_INTERVAL", time.Minute)
+}
+
+// GetEmailVerificationTokenTTL returns how long email verification tokens are valid, configured through EMAIL_VERIFICATION_TOKEN_TTL
+func GetEmailVerificationTokenTTL() time.Duration {
+	return getDurationEnv("EMAIL_VERIFICATION_TOKEN_TTL", 24*time.Hour)
+}
+
+// GetEmailVerificationResendInterval returns the minimum time between two verification emails,
+// configured through EMAIL_VERIFICATION_RESEND_INTERVAL
+func GetEmailVerificationResendInterval() time.Duration {
+	return getDurationEnv("EMAIL_VERIFICATION_RESEND_INTERVAL", time.Minute)
+}
+
+// RequireVerifiedEmail reports whether users must verify their email before they can be assigned
+// tasks or upload assets. Set REQUIRE_VERIFIED_EMAIL=false to disable the restriction.
+func RequireVerifiedEmail() bool {
+	return os.Getenv("REQUIRE_VERIFIED_EMAIL") != "false"
+}
+
+// GetMaxUploadSize returns the largest accepted asset upload in bytes, configured through MAX_UPLOAD_SIZE (default 10 MiB)
+func GetMaxUploadSize() int64 {
+	return int64(getIntEnv("MAX_UPLOAD_SIZE", 10<<20))
+}
+
+// GetAllowedUploadTypes returns the MIME types accepted for asset uploads, configured through
+// UPLOAD_ALLOWED_TYPES as a comma separated list. Entries like "image/*" allow a whole family.
+func GetAllowedUploadTypes() []string {
+	value := os.Getenv("UPLOAD_ALLOWED_TYPES")
+	if value == "" {
+		// SVG and HTML are left out on purpose, browsers run scripts embedded in them
+		value = "image/png,image/jpeg,image/gif,image/webp,application/pdf,text/plain,text/csv,application/zip," +
+			"application/vnd.openxmlformats-officedocument.wordprocessingml.document," +
+			"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet," +
+			"application/vnd.openxmlformats-officedocument.presentationml.presentation"
+	}
+
+	var types []string
+	for _, t := range strings.Split(value, ",") {
+		if t = strings.ToLower(strings.TrimSpace(t)); t != "" {
+			types = append(types, t)
+		}
+	}
+	return types
+}
+
+// GetAppURL returns the public URL of the frontend used in links sent by email, configured through APP_URL
+func GetAppURL() string {
+	url := os.Getenv("APP_URL")
+	if url == "" {
+		return "http://localhost:3000"
 	}
-	return []byte(secret)
+	return strings.TrimRight(url, "/")
 }
 
-// GenerateToken generates a JWT token for a given user ID
-func GenerateToken(userID uint) (string, error) {
+// GetLoginMaxFailures returns how many failed logins lock an account, configured through LOGIN_MAX_FAILURES
+func GetLoginMaxFailures() int {
+	return getIntEnv("LOGIN_MAX_FAILURES", 5)
+}
+
+// GetLoginIPMaxFailures returns how many failed logins lock out a client IP, configured through LOGIN_IP_MAX_FAILURES
+func GetLoginIPMaxFailures() int {
+	return getIntEnv("LOGIN_IP_MAX_FAILURES", 20)
+}
+
+// GetLoginLockoutDuration returns how long a lockout lasts, configured through LOGIN_LOCKOUT_DURATION.
+// Failure counters also reset after this long without a failed attempt.
+func GetLoginLockoutDuration() time.Duration {
+	return getDurationEnv("LOGIN_LOCKOUT_DURATION", 15*time.Minute)
+}
+
+// GetLoginBackoffBase returns the delay required after the first failed login, doubled for every
+// further failure. Configured through LOGIN_BACKOFF_BASE.
+func GetLoginBackoffBase() time.Duration {
+	return getDurationEnv("LOGIN_BACKOFF_BASE", time.Second)
+}
+
+// getIntEnv parses a positive integer from the environment, falling back to def
+func getIntEnv(key string, def int) int {
+	value, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || value <= 0 {
+		return def
+	}
+	return value
+}
+
+// getDurationEnv parses a duration (e.g. "15m", "720h") from the environment, falling back to def
+func getDurationEnv(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return def
+	}
+	return duration
+}
+
+// GetJWTIssuer returns the iss claim of issued tokens, configured through JWT_ISSUER
+func GetJWTIssuer() string {
+	issuer := os.Getenv("JWT_ISSUER")
+	if issuer == "" {
+		return "project-management"
+	}
+	return issuer
+}
+
+// GetJWTAudience returns the aud claim of access tokens, configured through JWT_AUDIENCE. Services
+// verifying access tokens against the JWKS should require this audience.
+func GetJWTAudience() string {
+	audience := os.Getenv("JWT_AUDIENCE")
+	if audience == "" {
+		return "project-management-api"
+	}
+	return audience
+}
+
+// impersonationAudience is the aud claim of impersonation tokens. They are only meant for this API,
+// a service requiring the access token audience rejects them.
+func impersonationAudience() string {
+	return GetJWTAudience() + "/impersonation"
+}
+
+// challengeAudience is the aud claim of 2FA challenge tokens
+func challengeAudience() string {
+	return GetJWTIssuer() + "/2fa"
+}
+
+// GenerateToken generates a short-lived JWT access token for a given user ID.
+// tokenVersion must match the user's current version and the session must not be revoked for the token to be accepted.
+func GenerateToken(userID uint, tokenVersion uint, sessionID uint) (string, error) {
 	// Set token claims
 	claims := jwt.MapClaims{
 		"user_id": userID,
-		"exp":     time.Now().Add(72 * time.Hour).Unix(),
+		"ver":     tokenVersion,
+		"sid":     sessionID,
+		"aud":     GetJWTAudience(),
+		"exp":     time.Now().Add(GetAccessTokenTTL()).Unix(),
 		"iat":     time.Now().Unix(),
 	}
 
-	// Create token
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	// Sign token with the active key
+	return signJWT(claims, tokenTypeAccess)
+}
 
-	// Sign token
-	tokenString, err := token.SignedString(GetJWTSecret())
+// ParseToken parses a JWT access or impersonation token and returns its claims
+func ParseToken(tokenStr string) (*AccessTokenClaims, error) {
+	// Parse and verify token
+	claims, err := parseJWT(tokenStr, tokenTypeAccess, GetJWTAudience(), impersonationAudience())
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	return tokenString, nil
-}
+	// Extract user_id
+	userIDFloat, ok := claims["user_id"].(float64)
+	if !ok {
+		return nil, errors.New("user_id not found in token")
+	}
+
+	// Tokens issued before versioning carry no ver claim and are treated as version 0
+	versionFloat, _ := claims["ver"].(float64)
+
+	// Tokens issued before session tracking carry no sid claim and are rejected by the middleware
+	sessionFloat, _ := claims["sid"].(float64)
 
-// ParseToken parses a JWT token and returns the user ID
-func ParseToken(tokenStr string) (uint, error) {
-	// Parse token
-	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-		// Validate signing algorithm
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
+	// Impersonation tokens name the acting admin in the act claim (RFC 8693) and only they may carry it
+	var impersonatorFloat float64
+	act, hasAct := claims["act"].(map[string]interface{})
+	if hasAct != claims.VerifyAudience(impersonationAudience(), true) {
+		return nil, errors.New("invalid act claim")
+	}
+	if hasAct {
+		impersonatorFloat, _ = act["user_id"].(float64)
+		if impersonatorFloat == 0 {
+			return nil, errors.New("invalid act claim")
 		}
-		return GetJWTSecret(), nil
-	})
+	}
 
-	if err != nil || !token.Valid {
-		return 0, errors.New("invalid token")
+	return &AccessTokenClaims{
+		UserID:         uint(userIDFloat),
+		TokenVersion:   uint(versionFloat),
+		SessionID:      uint(sessionFloat),
+		ImpersonatorID: uint(impersonatorFloat),
+	}, nil
+}
+
+// GenerateImpersonationToken generates a short-lived access token for userID used by the admin
+// impersonatorID. It is bound to the admin's session and ends with it.
+func GenerateImpersonationToken(userID uint, tokenVersion uint, impersonatorID uint, sessionID uint) (string, error) {
+	claims := jwt.MapClaims{
+		"user_id": userID,
+		"ver":     tokenVersion,
+		"sid":     sessionID,
+		"act":     map[string]interface{}{"user_id": impersonatorID},
+		"aud":     impersonationAudience(),
+		"exp":     time.Now().Add(GetImpersonationTokenTTL()).Unix(),
+		"iat":     time.Now().Unix(),
 	}
 
-	// Extract claims
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		return 0, errors.New("invalid token claims")
+	return signJWT(claims, tokenTypeAccess)
+}
+
+// GenerateTwoFactorChallenge generates a short-lived token proving that the password step of a
+// two-factor login succeeded. Its type and audience keep it from being used as an access token.
+func GenerateTwoFactorChallenge(userID uint, tokenVersion uint) (string, error) {
+	claims := jwt.MapClaims{
+		"user_id": userID,
+		"ver":     tokenVersion,
+		"purpose": "2fa",
+		"aud":     challengeAudience(),
+		"exp":     time.Now().Add(5 * time.Minute).Unix(),
+		"iat":     time.Now().Unix(),
+	}
+
+	return signJWT(claims, tokenTypeChallenge)
+}
+
+// ParseTwoFactorChallenge parses a token created by GenerateTwoFactorChallenge
+func ParseTwoFactorChallenge(tokenStr string) (*AccessTokenClaims, error) {
+	claims, err := parseJWT(tokenStr, tokenTypeChallenge, challengeAudience())
+	if err != nil || claims["purpose"] != "2fa" {
+		return nil, errors.New("invalid challenge token")
 	}
 
-	// Extract user_id
 	userIDFloat, ok := claims["user_id"].(float64)
 	if !ok {
-		return 0, errors.New("user_id not found in token")
+		return nil, errors.New("user_id not found in token")
+	}
+	versionFloat, _ := claims["ver"].(float64)
+
+	return &AccessTokenClaims{
+		UserID:       uint(userIDFloat),
+		TokenVersion: uint(versionFloat),
+	}, nil
+}
+
+// GetTOTPIssuer returns the issuer name shown in authenticator apps, configured through TOTP_ISSUER
+func GetTOTPIssuer() string {
+	issuer := os.Getenv("TOTP_ISSUER")
+	if issuer == "" {
+		return "Project Management"
+	}
+	return issuer
+}
+
+// GenerateRandomToken returns a URL-safe random string built from n random bytes
+func GenerateRandomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
 
-	return uint(userIDFloat), nil
+// HashToken returns the hex encoded SHA-256 of a token so it can be stored and looked up safely
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
 // CreateDirIfNotExists creates a directory if it does not exist